@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/compiler"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/module"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+)
+
+// compiledExt is the extension of compiled files
+const compiledExt = ".mkc"
+
+// runCompile handles `compile [-o out.mkc] script.mk`, the output defaults
+// to the script path with the compiled extension
+func runCompile(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { io.WriteString(stderr, usage) }
+	out := flags.String("o", "", "write the compiled file to this path")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		io.WriteString(stderr, usage)
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + compiledExt
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return exitError
+	}
+	p := parser.New(lexer.NewFile(path, string(src)))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		diagnostic.RenderAll(stderr, string(src), p.Diagnostics())
+		return exitError
+	}
+	bytecode, err := compileProgram(program)
+	var d *diagnostic.Diagnostic
+	if errors.As(err, &d) {
+		diagnostic.Render(stderr, string(src), d)
+		return exitError
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(*out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runCompiled runs a compiled file. The source is not part of it so
+// errors only point at the position.
+func runCompiled(modules *module.Loader, path string, data []byte, args []string, stderr io.Writer) (code int) {
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		fmt.Fprintf(stderr, "error: %s: %s\n", path, err)
+		return exitError
+	}
+	// the file may still unbalance the stack, which the vm trusts the
+	// compiler for
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(stderr, "error: %s: corrupt bytecode: %v\n", path, r)
+			code = exitError
+		}
+	}()
+	if errObj, ok := runBytecode(modules, bytecode, args).(*object.Error); ok {
+		// the script the file was compiled from shows the source when
+		// it is still around
+		src, _ := os.ReadFile(errObj.Pos.File)
+		render(stderr, modules, string(src), errObj.Diagnostic())
+		return exitError
+	}
+	return exitOK
+}
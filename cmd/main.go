@@ -1,17 +1,89 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/module"
 	"github.com/assimad8/go-interpreter/internal/repl"
 )
-func main(){
-	user,err := user.Current()
-	if err!=nil {
+
+const usage = `usage:
+  go-interpreter                         start the REPL
+  go-interpreter run script.mk [args...] execute a script file
+  go-interpreter -e 'source' [args...]   evaluate source and print the result
+  go-interpreter compile [-o out.mkc] script.mk
+                                         compile a script to bytecode
+  go-interpreter script.mkc [args...]    execute a compiled file
+
+flags:
+  -engine eval|vm  run with the tree-walking evaluator (default) or
+                   compile to bytecode and run on the virtual machine
+  -path dirs       directories searched for imported modules after the
+                   one of the importing script, separated by the OS path
+                   list separator
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("go-interpreter", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { io.WriteString(stderr, usage) }
+	source := flags.String("e", "", "evaluate the given source and print the result")
+	engine := flags.String("engine", engineEval, "execution engine, eval or vm")
+	searchPath := flags.String("path", "", "module search path")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *engine != engineEval && *engine != engineVM {
+		fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+		io.WriteString(stderr, usage)
+		return exitUsage
+	}
+	rest := flags.Args()
+	modules := module.NewLoader(filepath.SplitList(*searchPath))
+	// -e '' evaluates the empty source, it does not start the REPL
+	evalSource := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "e" {
+			evalSource = true
+		}
+	})
+
+	switch {
+	case evalSource:
+		return runSource(*engine, modules, "<eval>", *source, rest, true, stdout, stderr)
+	case len(rest) > 0 && rest[0] == "run":
+		if len(rest) < 2 {
+			io.WriteString(stderr, usage)
+			return exitUsage
+		}
+		return runFile(*engine, modules, rest[1], rest[2:], stdout, stderr)
+	case len(rest) > 0 && rest[0] == "compile":
+		return runCompile(rest[1:], stderr)
+	case len(rest) > 0 && strings.HasSuffix(rest[0], compiledExt):
+		return runFile(*engine, modules, rest[0], rest[1:], stdout, stderr)
+	case len(rest) > 0:
+		fmt.Fprintf(stderr, "unknown command %q\n", rest[0])
+		io.WriteString(stderr, usage)
+		return exitUsage
+	}
+
+	user, err := user.Current()
+	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s! This is the EMAD programming language!\n",user.Username)
-	fmt.Print("Feel free to type in Commands\n")
-	repl.Start(os.Stdin,os.Stdout)
-}
\ No newline at end of file
+	fmt.Fprintf(stdout, "Hello %s! This is the EMAD programming language!\n", user.Username)
+	fmt.Fprint(stdout, "Feel free to type in Commands\n")
+	repl.Start(stdin, stdout, modules)
+	return exitOK
+}
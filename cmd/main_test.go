@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/compiler"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	src := "#!/usr/bin/env go-interpreter run\nputs(args[0] + args[1]);\n"
+	if err := os.WriteFile(script, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"-e", "1 + 2"}, exitOK, "3\n", ""},
+		{[]string{"-e", ""}, exitOK, "", ""},
+		{[]string{"-engine", "vm", "-e", ""}, exitOK, "", ""},
+		{[]string{"-e", "len(args)", "a", "b"}, exitOK, "2\n", ""},
+		{[]string{"-e", "let x = ;"}, exitError, "", "error[P002]"},
+		{[]string{"-e", "1 + true"}, exitError, "", "type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run", script, "a", "b"}, exitOK, "", ""},
+		{[]string{"run", filepath.Join(dir, "missing.mk")}, exitError, "", "no such file"},
+		{[]string{"run"}, exitUsage, "", "usage:"},
+		{[]string{"build"}, exitUsage, "", "unknown command"},
+		{[]string{"-engine", "vm", "-e", "let f = fn(n) { n * 2 }; f(len(args))", "a"}, exitOK, "2\n", ""},
+		{[]string{"-engine", "vm", "-e", "1 + true"}, exitError, "", "type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"-engine", "vm", "run", script, "a", "b"}, exitOK, "", ""},
+		{[]string{"-engine", "jit", "-e", "1"}, exitUsage, "", "unknown engine"},
+		{[]string{"-e", "let f = fn() { 1 + true }; f()"}, exitError, "", "at f (<eval>:1:16)\n      at <main> (<eval>:1:28)\n"},
+		{[]string{"-engine", "vm", "-e", "let f = fn() { 1 + true }; f()"}, exitError, "", "at f (<eval>:1:16)\n      at <main> (<eval>:1:28)\n"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d (%s)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if stdout.String() != tt.expectedStdout {
+			t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: stderr does not contain %q. got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestCompileAndRunCompiled(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	src := "let greet = fn(name) { name - 1 };\ngreet(args[0]);\n"
+	if err := os.WriteFile(script, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	compiled := filepath.Join(dir, "out.mkc")
+	stale := filepath.Join(dir, "stale.mkc")
+	if err := os.WriteFile(stale, []byte("MKC\x00\x7f"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// pops from the empty stack
+	corrupt := filepath.Join(dir, "corrupt.mkc")
+	ins := append(code.Make(code.OpPop), code.Make(code.OpReturnValue)...)
+	data, err := (&compiler.Bytecode{Main: &object.CompiledFunction{Instructions: ins}}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(corrupt, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"compile", "-o", compiled, script}, exitOK, ""},
+		{[]string{compiled, "hi"}, exitError, script + ":1:24\n  |\n1 | let greet"},
+		{[]string{"run", compiled, "hi"}, exitError, "unknown operator: STRING - INTEGER"},
+		{[]string{"compile", script}, exitOK, ""},
+		{[]string{filepath.Join(dir, "script.mkc"), "hi"}, exitError, "unknown operator: STRING - INTEGER"},
+		{[]string{stale}, exitError, "incompatible bytecode format version"},
+		{[]string{corrupt}, exitError, "corrupt.mkc: corrupt bytecode"},
+		{[]string{"run", script}, exitError, "type mismatch: NULL - INTEGER"},
+		{[]string{"compile"}, exitUsage, "usage:"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d (%s)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: stderr does not contain %q. got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestRunImports(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	if err := os.Mkdir(lib, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "main.mk"):  "import { shout } from \"text\";\nputs(shout(args[0]));\n",
+		filepath.Join(lib, "text.mk"):  "export let shout = fn(s) { s - \"!\" };\n",
+		filepath.Join(dir, "other.mk"): "import \"./lib/text\";\nputs(text[\"shout\"]);\n",
+	}
+	for path, src := range files {
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{[]string{"run", script, "hi"}, exitError, `cannot find module "text"`},
+		// the error points into the module and shows its source
+		{[]string{"-path", lib, "run", script, "hi"}, exitError, "1 | export let shout = fn(s) { s - \"!\" };"},
+		{[]string{"-engine", "vm", "-path", lib, "run", script, "hi"}, exitError, "at shout (" + filepath.Join(lib, "text.mk") + ":1:28)"},
+		{[]string{"run", filepath.Join(dir, "other.mk")}, exitOK, ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%v: wrong exit code. expected=%d, got=%d (%s)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) {
+			t.Errorf("%v: stderr does not contain %q. got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/compiler"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/module"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+	"github.com/assimad8/go-interpreter/internal/vm"
+)
+
+// process exit codes
+const (
+	exitOK    = 0
+	exitError = 1 // the script failed to parse or raised an error
+	exitUsage = 2
+)
+
+// execution engines selected with -engine
+const (
+	engineEval = "eval"
+	engineVM   = "vm"
+)
+
+// runFile runs a script, or a compiled file on the vm whatever the engine
+func runFile(engine string, modules *module.Loader, path string, args []string, stdout, stderr io.Writer) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %s\n", err)
+		return exitError
+	}
+	if compiler.IsCompiled(src) {
+		return runCompiled(modules, path, src, args, stderr)
+	}
+	return runSource(engine, modules, path, string(src), args, false, stdout, stderr)
+}
+
+// runSource evaluates src with the script arguments bound to `args`,
+// the result is printed only when printResult is set
+func runSource(engine string, modules *module.Loader, file, src string, args []string, printResult bool, stdout, stderr io.Writer) int {
+	l := lexer.NewFile(file, src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		diagnostic.RenderAll(stderr, src, p.Diagnostics())
+		return exitError
+	}
+
+	var evaluated object.Object
+	if engine == engineVM {
+		var err error
+		evaluated, err = runVM(modules, program, args)
+		var d *diagnostic.Diagnostic
+		if errors.As(err, &d) {
+			diagnostic.Render(stderr, src, d)
+			return exitError
+		}
+	} else {
+		env := object.NewEnvironment()
+		env.Set("args", scriptArgs(args))
+		evaluated = evaluator.New(evaluator.Options{Modules: modules}).Eval(program, env)
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		render(stderr, modules, src, errObj.Diagnostic())
+		return exitError
+	}
+	if printResult && evaluated != nil && evaluated != evaluator.NULL {
+		io.WriteString(stdout, evaluated.Inspect())
+		io.WriteString(stdout, "\n")
+	}
+	return exitOK
+}
+
+// runVM compiles program and runs it on the vm, the error is the
+// compiler's diagnostic
+func runVM(modules *module.Loader, program *ast.Program, args []string) (object.Object, error) {
+	bytecode, err := compileProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	return runBytecode(modules, bytecode, args), nil
+}
+
+// compileProgram compiles a script with `args` as its first global
+func compileProgram(program *ast.Program) (*compiler.Bytecode, error) {
+	symbols := compiler.NewSymbolTable()
+	symbols.Define("args")
+
+	c := compiler.NewWithState(symbols, nil)
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+	return c.Bytecode(), nil
+}
+
+func runBytecode(modules *module.Loader, bytecode *compiler.Bytecode, args []string) object.Object {
+	globals := make([]object.Object, vm.GlobalsSize)
+	if i := slices.Index(bytecode.Globals, "args"); i >= 0 {
+		globals[i] = scriptArgs(args)
+	}
+	machine := vm.NewWithGlobals(bytecode, globals)
+	machine.SetModules(modules)
+	return machine.Run()
+}
+
+// render prints d with the source it points at, which is the one of an
+// imported module for the errors raised inside it
+func render(out io.Writer, modules *module.Loader, src string, d *diagnostic.Diagnostic) {
+	if moduleSrc, ok := modules.Source(d.Span.Start.File); ok {
+		src = moduleSrc
+	}
+	diagnostic.Render(out, src, d)
+}
+
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, 0, len(args))
+	for _, arg := range args {
+		elements = append(elements, &object.String{Value: arg})
+	}
+	return &object.Array{Elements: elements}
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"github.com/assimad8/go-interpreter/internal/token"
@@ -10,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String()       string
+	Pos()          token.Position // position of the first character of the node
+	End()          token.Position // position right after the last character of the node
 }
 
 type Statement interface {
@@ -40,6 +43,18 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
 //LET IDEN   EXPRESSION
 //let name = "emad"
 //let name = 5*5
@@ -61,13 +76,22 @@ func (ls *LetStatement) String() string {
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
 	}
-	out.WriteString(";")
 
 	return out.String()
 }
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+	return ls.Token.End
+}
 
 
 //identifier like let x = 3; x is the identifier
@@ -82,6 +106,8 @@ func (i *Identifier) String() string {return i.Value}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
+func (i *Identifier) End() token.Position { return i.Token.End }
 
 //return statement return [expression]
 type ReturnStatement struct {
@@ -103,6 +129,13 @@ func (rs *ReturnStatement) String() string {
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+	return rs.Token.End
+}
 
 //expressionStatement statement x+4; 5+5; add(3,4)+3;
 type ExpressionStatement struct {
@@ -120,6 +153,18 @@ func (es *ExpressionStatement) String() string {
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() token.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+	return es.Token.Pos
+}
+func (es *ExpressionStatement) End() token.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+	return es.Token.End
+}
 
 //integerLiteral for integer in the expression
 type IntegerLiteral struct {
@@ -134,6 +179,20 @@ func( il *IntegerLiteral) TokenLiteral() string {
 func( il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position { return il.Token.End }
+
+//floatLiteral for numbers with a fraction or an exponent
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position { return fl.Token.End }
 
 //prefix expression !x, -x...
 type PrefixExpression struct {
@@ -155,6 +214,13 @@ func( pe *PrefixExpression) String() string {
 	
 	return out.String()
 }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Pos }
+func (pe *PrefixExpression) End() token.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+	return pe.Token.End
+}
 
 //infix expression x + x, x + 34 , 3 * 4 ....
 
@@ -180,6 +246,18 @@ func (ie *InfixExpression) String() string {
 
 	return out.String()
 }
+func (ie *InfixExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *InfixExpression) End() token.Position {
+	if ie.Right != nil {
+		return ie.Right.End()
+	}
+	return ie.Token.End
+}
 
 //Boolean literals
 type Boolean struct {
@@ -190,6 +268,8 @@ type Boolean struct {
 func(b *Boolean) expressionNode() {}
 func(b *Boolean) TokenLiteral() string {return b.Token.Literal}
 func(b *Boolean) String() string {return b.Token.Literal}
+func (b *Boolean) Pos() token.Position { return b.Token.Pos }
+func (b *Boolean) End() token.Position { return b.Token.End }
 
 //If else expression
 type IfExpression struct {
@@ -213,9 +293,21 @@ func(ie *IfExpression) String() string {
 	}
 	return out.String()
 }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Pos }
+func (ie *IfExpression) End() token.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+	if ie.Consequence != nil {
+		return ie.Consequence.End()
+	}
+	return ie.Token.End
+}
+
 type BlockStatement struct {
 	Token token.Token // the { token
 	Statements []Statement
+	Rbrace token.Token // the } token
 }
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
@@ -226,6 +318,8 @@ func (bs *BlockStatement) String() string {
 	}
 	return out.String()
 }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position { return bs.Rbrace.End }
 
 //Function
 type FunctionLiteral struct {
@@ -255,12 +349,20 @@ func (fl *FunctionLiteral) String() string {
 
 	return out.String()
 }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
 
 // call a function in the program
 type CallExpression struct {
 	Token token.Token // the '(' token
 	Function Expression // Identifier or FunctionLiteral
 	Arguments []Expression
+	Rparen token.Token // the ')' token
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -282,6 +384,13 @@ func(ce *CallExpression) String() string {
 
 	return out.String()
 }
+func (ce *CallExpression) Pos() token.Position {
+	if ce.Function != nil {
+		return ce.Function.Pos()
+	}
+	return ce.Token.Pos
+}
+func (ce *CallExpression) End() token.Position { return ce.Rparen.End }
 
 // String datatype
 
@@ -297,11 +406,39 @@ func (sl *StringLiteral) TokenLiteral() string {
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position { return sl.Token.End }
+
+// "text ${expr} text", Texts has one more element than Exprs: the text
+// before each expression and the one after the last
+type InterpolatedString struct {
+	Token token.Token // the INTERPOLATED token
+	Texts []string
+	Exprs []Expression
+}
+
+func (is *InterpolatedString) expressionNode() {}
+func (is *InterpolatedString) TokenLiteral() string {
+	return is.Token.Literal
+}
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	for i,text := range is.Texts {
+		out.WriteString(text)
+		if i < len(is.Exprs) {
+			out.WriteString("${"+is.Exprs[i].String()+"}")
+		}
+	}
+	return out.String()
+}
+func (is *InterpolatedString) Pos() token.Position { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position { return is.Token.End }
 
 // Array literal
 type ArrayLiteral struct {
 	Token token.Token // thre '[' token
 	Elements []Expression
+	Rbracket token.Token // the ']' token
 }
 
 func (al *ArrayLiteral) expressionNode(){}
@@ -321,12 +458,15 @@ func (al *ArrayLiteral) String() string{
 
 	return out.String()
 }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position { return al.Rbracket.End }
 
 // Index expression for array
 type IndexExpression struct {
 	Token 	token.Token // the [ token
 	Left 	Expression // the array or identifier
 	Index 	Expression // the index expression
+	Rbracket token.Token // the ] token
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -344,12 +484,21 @@ func (ie *IndexExpression) String() string {
 
 	return out.String()
 }
+func (ie *IndexExpression) Pos() token.Position {
+	if ie.Left != nil {
+		return ie.Left.Pos()
+	}
+	return ie.Token.Pos
+}
+func (ie *IndexExpression) End() token.Position { return ie.Rbracket.End }
 
 //hash table data type
 
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys []Expression // the keys of Pairs in source order
+	Rbrace token.Token // the '}' token
 }
 
 func (hl *HashLiteral) expressionNode() {}
@@ -360,12 +509,303 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
 
-	for key,value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _,key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs,", "))
 	out.WriteString("}")
 	return out.String()
-}
\ No newline at end of file
+}
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Pos }
+func (hl *HashLiteral) End() token.Position { return hl.Rbrace.End }
+
+// while (condition) { body }
+type WhileStatement struct {
+	Token     token.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return ws.Token.End
+}
+
+// for (value in iterable) { body } or for (key, value in iterable) { body }
+type ForInStatement struct {
+	Token    token.Token // the 'for' token
+	Key      *Identifier // nil when only one variable is given
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode() {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+func (fs *ForInStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *ForInStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+
+// for (init; condition; post) { body }, every clause is optional
+type ForStatement struct {
+	Token     token.Token // the 'for' token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(fs.Init.String())
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return fs.Token.End
+}
+
+// break; leaves the innermost loop
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string { return bs.Token.Literal + ";" }
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position { return bs.Token.End }
+
+// try { body } catch (param) { catch } finally { finally }, catch
+// or finally may be missing but not both
+type TryStatement struct {
+	Token   token.Token // the 'try' token
+	Body    *BlockStatement
+	Param   *Identifier     // the caught error, nil without catch
+	Catch   *BlockStatement // nil without catch
+	Finally *BlockStatement // nil without finally
+}
+
+func (ts *TryStatement) statementNode() {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(ts.Body.String())
+	if ts.Catch != nil {
+		out.WriteString(" catch (" + ts.Param.String() + ") ")
+		out.WriteString(ts.Catch.String())
+	}
+	if ts.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(ts.Finally.String())
+	}
+
+	return out.String()
+}
+func (ts *TryStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *TryStatement) End() token.Position {
+	switch {
+	case ts.Finally != nil:
+		return ts.Finally.End()
+	case ts.Catch != nil:
+		return ts.Catch.End()
+	case ts.Body != nil:
+		return ts.Body.End()
+	}
+	return ts.Token.End
+}
+
+// throw value; raises an error that try can catch
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string { return "throw " + ts.Value.String() + ";" }
+func (ts *ThrowStatement) Pos() token.Position { return ts.Token.Pos }
+func (ts *ThrowStatement) End() token.Position {
+	if ts.Value != nil {
+		return ts.Value.End()
+	}
+	return ts.Token.End
+}
+
+// import "path/to/lib"; binds the module to Name, the last element of
+// the path. import { a, b } from "lib"; binds the listed exports instead.
+type ImportStatement struct {
+	Token token.Token // the 'import' token
+	Path  *StringLiteral
+	Name  string        // the binding of the module when Names is empty
+	Names []*Identifier // the imported exports
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	if len(is.Names) == 0 {
+		return "import " + strconv.Quote(is.Path.Value) + ";"
+	}
+	names := make([]string, 0, len(is.Names))
+	for _, name := range is.Names {
+		names = append(names, name.String())
+	}
+	return "import { " + strings.Join(names, ", ") + " } from " + strconv.Quote(is.Path.Value) + ";"
+}
+func (is *ImportStatement) Pos() token.Position { return is.Token.Pos }
+func (is *ImportStatement) End() token.Position {
+	if is.Path != nil {
+		return is.Path.End()
+	}
+	return is.Token.End
+}
+
+// export let name = value; makes a top level binding importable
+type ExportStatement struct {
+	Token     token.Token // the 'export' token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string { return "export " + es.Statement.String() }
+func (es *ExportStatement) Pos() token.Position { return es.Token.Pos }
+func (es *ExportStatement) End() token.Position {
+	if es.Statement != nil {
+		return es.Statement.End()
+	}
+	return es.Token.End
+}
+
+// continue; skips to the next iteration of the innermost loop
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string { return cs.Token.Literal + ";" }
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position { return cs.Token.End }
+
+// assignment x = 5, x += 1, arr[0] = 2, hash["k"] = v
+type AssignExpression struct {
+	Token    token.Token // the = or compound assignment token
+	Target   Expression  // an *Identifier or an *IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+func (ae *AssignExpression) Pos() token.Position {
+	if ae.Target != nil {
+		return ae.Target.Pos()
+	}
+	return ae.Token.Pos
+}
+func (ae *AssignExpression) End() token.Position {
+	if ae.Value != nil {
+		return ae.Value.End()
+	}
+	return ae.Token.End
+}
+
+// increment and decrement ++x, x--, arr[0]++
+type UpdateExpression struct {
+	Token    token.Token // the ++ or -- token
+	Operator string
+	Target   Expression // an *Identifier or an *IndexExpression
+	Prefix   bool
+}
+
+func (ue *UpdateExpression) expressionNode() {}
+func (ue *UpdateExpression) TokenLiteral() string { return ue.Token.Literal }
+func (ue *UpdateExpression) String() string {
+	if ue.Prefix {
+		return "(" + ue.Operator + ue.Target.String() + ")"
+	}
+	return "(" + ue.Target.String() + ue.Operator + ")"
+}
+func (ue *UpdateExpression) Pos() token.Position {
+	if !ue.Prefix && ue.Target != nil {
+		return ue.Target.Pos()
+	}
+	return ue.Token.Pos
+}
+func (ue *UpdateExpression) End() token.Position {
+	if ue.Prefix && ue.Target != nil {
+		return ue.Target.End()
+	}
+	return ue.Token.End
+}
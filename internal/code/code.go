@@ -0,0 +1,249 @@
+// Package code defines the bytecode instructions executed by the vm
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		i += 1 + read
+	}
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), len(def.OperandWidths))
+	}
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+	OpMinus
+	OpBang
+	OpUpdate
+
+	OpJump
+	OpJumpNotTruthy
+	OpJumpIfFalseOrPop
+	OpJumpIfTrueOrPop
+
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal
+	OpGetLocal
+	OpSetLocal
+	OpAssignLocal
+	OpUnsetLocal
+	OpGetFree
+	OpAssignFree
+	OpGetBuiltin
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpIndexCompound
+	OpIndexUpdate
+
+	OpCellLocal
+	OpCellFree
+	OpClosure
+	OpCall
+	OpReturnValue
+
+	OpIterInit
+	OpIterNext
+
+	OpTry
+	OpEndTry
+	OpThrow
+
+	OpImport
+	OpInterpolate
+)
+
+// Definition gives the readable name of an opcode and the width in bytes
+// of each of its operands
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{}},
+	OpTrue:     {"OpTrue", []int{}},
+	OpFalse:    {"OpFalse", []int{}},
+	OpNull:     {"OpNull", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpMinus:        {"OpMinus", []int{}},
+	OpBang:         {"OpBang", []int{}},
+	// the operand is OpAdd for ++ and OpSub for --
+	OpUpdate: {"OpUpdate", []int{1}},
+
+	OpJump:             {"OpJump", []int{2}},
+	OpJumpNotTruthy:    {"OpJumpNotTruthy", []int{2}},
+	OpJumpIfFalseOrPop: {"OpJumpIfFalseOrPop", []int{2}},
+	OpJumpIfTrueOrPop:  {"OpJumpIfTrueOrPop", []int{2}},
+
+	// Set pops the value into a new variable, Assign rebinds a variable
+	// that must exist and leaves the value on the stack
+	OpGetGlobal:    {"OpGetGlobal", []int{2}},
+	OpSetGlobal:    {"OpSetGlobal", []int{2}},
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpGetLocal:     {"OpGetLocal", []int{2}},
+	OpSetLocal:     {"OpSetLocal", []int{2}},
+	OpAssignLocal:  {"OpAssignLocal", []int{2}},
+	OpUnsetLocal:   {"OpUnsetLocal", []int{2}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpAssignFree:   {"OpAssignFree", []int{1}},
+	// the operand is the constant holding the builtin's name
+	OpGetBuiltin: {"OpGetBuiltin", []int{2}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+	// the operand is the opcode of the binary operator
+	OpIndexCompound: {"OpIndexCompound", []int{1}},
+	// operator opcode and 1 for postfix
+	OpIndexUpdate: {"OpIndexUpdate", []int{1, 1}},
+
+	OpCellLocal:   {"OpCellLocal", []int{2}},
+	OpCellFree:    {"OpCellFree", []int{1}},
+	OpClosure:     {"OpClosure", []int{2, 1}},
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+
+	// 1 when the loop has a key variable, OpIterNext then pushes the
+	// value and the key
+	OpIterInit: {"OpIterInit", []int{1}},
+	// the operand is the jump target once the iterator is exhausted
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	// the operand is the handler an error of the protected code jumps
+	// to, with the exception pushed
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	// the operand is the constant holding the import path, the module
+	// is pushed
+	OpImport: {"OpImport", []int{2}},
+	// the operand is the number of texts and values popped and joined
+	OpInterpolate: {"OpInterpolate", []int{2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+// Make encodes an instruction, operands are big endian
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction and returns how
+// many bytes it read
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,936 @@
+// Package compiler lowers the AST to bytecode for the vm
+package compiler
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// compile errors share the parser diagnostic format
+const (
+	CodeUnsupported = "C001"
+	CodeTooLarge    = "C002"
+	CodeTooDeep     = "C003"
+)
+
+var binaryOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+}
+
+// Bytecode is a compiled program, Main runs the top level statements and
+// returns the value of the last one
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+	Globals   []string // names of the global slots
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	sourceMap    []object.SourcePos
+	depth        int // values the code of this scope has on the stack
+	loops        []*loopScope
+	tries        []*tryScope
+}
+
+// loopScope collects the jumps of break and continue until the targets
+// are known
+type loopScope struct {
+	depth     int // stack depth at the start of an iteration
+	start     int // continue target, -1 while unknown
+	breaks    []int
+	continues []int
+}
+
+// tryScope is a try statement whose handler is set while its body, or
+// its catch block when it has a finally, runs. Jumping out of it pops
+// the handler and runs the finally block.
+type tryScope struct {
+	finally *ast.BlockStatement // nil without finally
+	loops   int                 // loops open when the try started
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	node    ast.Node // the node emitted instructions are mapped to
+	nesting int      // nodes being compiled, at most evaluator.MaxNesting
+	err     error
+}
+
+func New() *Compiler {
+	return NewWithState(NewSymbolTable(), []object.Object{})
+}
+
+// NewWithState compiles against the globals and constants of an earlier
+// compilation, the REPL keeps its definitions this way
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: s,
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// Compile compiles a program, the error is a *diagnostic.Diagnostic
+func (c *Compiler) Compile(node ast.Node) error {
+	if err := c.compile(node); err != nil {
+		return err
+	}
+	return c.err
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	globals := c.symbolTable
+	for globals.Outer != nil {
+		globals = globals.Outer
+	}
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			Name:         "main",
+			SourceMap:    scope.sourceMap,
+		},
+		Constants: c.constants,
+		Globals:   globals.Names(),
+	}
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	prev := c.node
+	c.node = node
+	c.nesting++
+	defer func() { c.node, c.nesting = prev, c.nesting-1 }()
+	if c.nesting > evaluator.MaxNesting {
+		return c.errorf(CodeTooDeep, "expression nested too deeply, the limit is %d levels", evaluator.MaxNesting)
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		if err := c.compileBlock(node.Statements); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	// Statements
+	case *ast.ExpressionStatement:
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		return c.compileBlock(node.Statements)
+	case *ast.LetStatement:
+		return c.compileLet(node)
+	case *ast.ReturnStatement:
+		if err := c.compile(node.ReturnValue); err != nil {
+			return err
+		}
+		if err := c.exitTries(0); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.WhileStatement:
+		return c.compileWhile(node)
+	case *ast.ForStatement:
+		return c.compileFor(node)
+	case *ast.ForInStatement:
+		return c.compileForIn(node)
+	case *ast.BreakStatement:
+		return c.compileLoopJump(true)
+	case *ast.ContinueStatement:
+		return c.compileLoopJump(false)
+	case *ast.ImportStatement:
+		return c.compileImport(node)
+	case *ast.ExportStatement:
+		return c.compile(node.Statement)
+	case *ast.TryStatement:
+		return c.compileTry(node)
+	case *ast.ThrowStatement:
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "-":
+			c.emit(code.OpMinus)
+		case "!":
+			c.emit(code.OpBang)
+		default:
+			return c.errorf(CodeUnsupported, "unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+	case *ast.IfExpression:
+		return c.compileIf(node)
+	case *ast.Identifier:
+		c.loadName(node.Value)
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+	case *ast.CallExpression:
+		if err := c.compile(node.Function); err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			if err := c.compile(arg); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.InterpolatedString:
+		n := 0
+		for i, text := range node.Texts {
+			if text != "" {
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: text}))
+				n++
+			}
+			if i < len(node.Exprs) {
+				if err := c.compile(node.Exprs[i]); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		c.emit(code.OpInterpolate, n)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			if err := c.compile(key); err != nil {
+				return err
+			}
+			if err := c.compile(node.Pairs[key]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.AssignExpression:
+		return c.compileAssign(node)
+	case *ast.UpdateExpression:
+		return c.compileUpdate(node)
+	default:
+		return c.errorf(CodeUnsupported, "compiler: unsupported node %T", node)
+	}
+	return nil
+}
+
+// compileBlock leaves the value of the last statement on the stack, null
+// when it is not an expression
+func (c *Compiler) compileBlock(stmts []ast.Statement) error {
+	for i, stmt := range stmts {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i == len(stmts)-1 {
+			return c.compile(es.Expression)
+		}
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpNull)
+	return nil
+}
+
+// compileStatements leaves nothing on the stack, for loop bodies
+func (c *Compiler) compileStatements(stmts []ast.Statement) error {
+	for _, stmt := range stmts {
+		if err := c.compile(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileLet(node *ast.LetStatement) error {
+	name := node.Name.Value
+	// a function literal is bound first so it can call itself
+	if fl, ok := node.Value.(*ast.FunctionLiteral); ok {
+		symbol := c.symbolTable.Define(name)
+		if err := c.compileFunction(fl, name); err != nil {
+			return err
+		}
+		c.setSymbol(symbol)
+		return nil
+	}
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	c.setSymbol(c.symbolTable.Define(name))
+	return nil
+}
+
+// hoistFunctions defines the functions bound by let in a scope before it
+// is compiled, so functions of the same scope can call each other
+func (c *Compiler) hoistFunctions(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+				c.symbolTable.Define(let.Name.Value)
+			}
+		}
+	}
+}
+
+func (c *Compiler) compileInfix(node *ast.InfixExpression) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	if node.Operator == "&&" || node.Operator == "||" {
+		// the left operand stays as the result when it decides
+		jump := code.OpJumpIfFalseOrPop
+		if node.Operator == "||" {
+			jump = code.OpJumpIfTrueOrPop
+		}
+		pos := c.emit(jump, 9999)
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.changeOperand(pos, len(c.currentInstructions()))
+		return nil
+	}
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+	op, ok := binaryOperators[node.Operator]
+	if !ok {
+		return c.errorf(CodeUnsupported, "unknown operator %s", node.Operator)
+	}
+	c.emit(op)
+	return nil
+}
+
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthy := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compile(node.Consequence); err != nil {
+		return err
+	}
+	jump := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthy, len(c.currentInstructions()))
+	// only one of the branches leaves its value
+	c.scope().depth--
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compile(node.Alternative); err != nil {
+		return err
+	}
+	c.changeOperand(jump, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileFunction(fl *ast.FunctionLiteral, name string) error {
+	prev := c.node
+	c.node = fl
+	defer func() { c.node = prev }()
+
+	c.enterScope()
+	for _, p := range fl.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	c.hoistFunctions(fl.Body.Statements)
+	if err := c.compile(fl.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	localNames := c.symbolTable.Names()
+	scope := c.leaveScope()
+
+	freeNames := make([]string, 0, len(freeSymbols))
+	for _, s := range freeSymbols {
+		if s.Scope == FreeScope {
+			c.emit(code.OpCellFree, s.Index)
+		} else {
+			c.emit(code.OpCellLocal, s.Index)
+		}
+		freeNames = append(freeNames, s.Name)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		NumLocals:     len(localNames),
+		NumParameters: len(fl.Parameters),
+		Name:          name,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+		SourceMap:     scope.sourceMap,
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) compileWhile(node *ast.WhileStatement) error {
+	start := len(c.currentInstructions())
+	loop := c.enterLoop()
+	loop.start = start
+
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	exit := len(c.currentInstructions())
+	c.changeOperand(exitJump, exit)
+	c.leaveLoop(start, exit)
+	return nil
+}
+
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	c.enterBlock()
+	if node.Init != nil {
+		if err := c.compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	start := len(c.currentInstructions())
+	exitJump := -1
+	if node.Condition != nil {
+		if err := c.compile(node.Condition); err != nil {
+			return err
+		}
+		exitJump = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+	c.enterLoop()
+	c.hoistFunctions(node.Body.Statements)
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+
+	post := len(c.currentInstructions())
+	if node.Post != nil {
+		if err := c.compile(node.Post); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, start)
+
+	exit := len(c.currentInstructions())
+	if exitJump >= 0 {
+		c.changeOperand(exitJump, exit)
+	}
+	c.leaveLoop(post, exit)
+	c.leaveBlock()
+	return nil
+}
+
+// compileForIn keeps an iterator on the stack while the loop runs, it
+// is popped at the exit that both break and the last iteration reach
+func (c *Compiler) compileForIn(node *ast.ForInStatement) error {
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+	withKey := 0
+	if node.Key != nil {
+		withKey = 1
+	}
+	c.emit(code.OpIterInit, withKey)
+
+	c.enterBlock()
+	value := c.symbolTable.Define(node.Value.Value)
+	var key Symbol
+	if node.Key != nil {
+		key = c.symbolTable.Define(node.Key.Value)
+	}
+
+	start := len(c.currentInstructions())
+	loop := c.enterLoop()
+	loop.start = start
+	next := c.emit(code.OpIterNext, 9999)
+	c.scope().depth += 1 + withKey
+	if node.Key != nil {
+		c.setSymbol(key)
+	}
+	c.setSymbol(value)
+
+	c.hoistFunctions(node.Body.Statements)
+	if err := c.compileStatements(node.Body.Statements); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, start)
+
+	exit := len(c.currentInstructions())
+	c.changeOperand(next, exit)
+	c.leaveLoop(start, exit)
+	c.emit(code.OpPop)
+	c.leaveBlock()
+	return nil
+}
+
+// compileLoopJump drops the values the enclosing expressions left on the
+// stack before jumping out of the iteration
+func (c *Compiler) compileLoopJump(isBreak bool) error {
+	scope := c.scope()
+	if len(scope.loops) == 0 {
+		return c.errorf(CodeUnsupported, "%s outside loop", c.node.TokenLiteral())
+	}
+	loop := scope.loops[len(scope.loops)-1]
+
+	depth := scope.depth
+	for i := loop.depth; i < depth; i++ {
+		c.emit(code.OpPop)
+	}
+	// the tries started inside the loop are left too
+	first := len(scope.tries)
+	for first > 0 && scope.tries[first-1].loops == len(scope.loops) {
+		first--
+	}
+	if err := c.exitTries(first); err != nil {
+		return err
+	}
+	scope = c.scope()
+	switch {
+	case isBreak:
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case loop.start >= 0:
+		c.emit(code.OpJump, loop.start)
+	default:
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+	}
+	// what follows in the block is never reached
+	c.scope().depth = depth
+	return nil
+}
+
+// compileImport binds the module, or each of the imported names read
+// from it like an index expression
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	c.emit(code.OpImport, c.addConstant(&object.String{Value: node.Path.Value}))
+	if len(node.Names) == 0 {
+		c.setSymbol(c.symbolTable.Define(node.Name))
+		return nil
+	}
+	for i, name := range node.Names {
+		if i < len(node.Names)-1 {
+			c.emit(code.OpDup)
+		}
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name.Value}))
+		c.emit(code.OpIndex)
+		c.setSymbol(c.symbolTable.Define(name.Value))
+	}
+	return nil
+}
+
+// compileTry lays out a try statement as
+//
+//	OpTry catch; body; OpEndTry; finally; OpJump end
+//	catch: bind e; OpTry rethrow; catch body; OpEndTry; finally; OpJump end
+//	rethrow: finally; OpThrow
+//	end:
+//
+// the catch block is only protected when there is a finally, without a
+// catch the handler runs the finally block and throws again
+func (c *Compiler) compileTry(node *ast.TryStatement) error {
+	depth := c.scope().depth
+	handler := c.emit(code.OpTry, 9999)
+	if err := c.compileProtected(node.Body, node.Finally); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	if err := c.compileFinally(node.Finally); err != nil {
+		return err
+	}
+	exits := []int{c.emit(code.OpJump, 9999)}
+
+	c.changeOperand(handler, len(c.currentInstructions()))
+	// the handler starts with the exception on the stack
+	c.scope().depth = depth + 1
+	if node.Catch != nil {
+		c.enterBlock()
+		c.setSymbol(c.symbolTable.Define(node.Param.Value))
+		c.hoistFunctions(node.Catch.Statements)
+		if node.Finally == nil {
+			if err := c.compileStatements(node.Catch.Statements); err != nil {
+				return err
+			}
+			c.leaveBlock()
+			exits = append(exits, c.emit(code.OpJump, 9999))
+		} else {
+			rethrow := c.emit(code.OpTry, 9999)
+			if err := c.compileProtected(node.Catch, node.Finally); err != nil {
+				return err
+			}
+			c.emit(code.OpEndTry)
+			c.leaveBlock()
+			if err := c.compileFinally(node.Finally); err != nil {
+				return err
+			}
+			exits = append(exits, c.emit(code.OpJump, 9999))
+
+			c.changeOperand(rethrow, len(c.currentInstructions()))
+			c.scope().depth = depth + 1
+		}
+	}
+	if node.Finally != nil {
+		if err := c.compileFinally(node.Finally); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	}
+
+	for _, pos := range exits {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.scope().depth = depth
+	return nil
+}
+
+// compileProtected compiles a block that runs with the handler of a try
+// set, return, break and continue leave it through exitTries
+func (c *Compiler) compileProtected(block, finally *ast.BlockStatement) error {
+	scope := c.scope()
+	scope.tries = append(scope.tries, &tryScope{finally: finally, loops: len(scope.loops)})
+	err := c.compileStatements(block.Statements)
+	// compiling a function may have moved the scopes
+	scope = c.scope()
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	return err
+}
+
+func (c *Compiler) compileFinally(finally *ast.BlockStatement) error {
+	if finally == nil {
+		return nil
+	}
+	return c.compileStatements(finally.Statements)
+}
+
+// exitTries pops the handlers of the tries from first on, innermost
+// first, and runs their finally blocks. A finally block is outside of
+// its own try, so the tries are cut while it is compiled.
+func (c *Compiler) exitTries(first int) error {
+	tries := c.scope().tries
+	defer func() { c.scope().tries = tries }()
+
+	for i := len(tries) - 1; i >= first; i-- {
+		c.scope().tries = tries[:i]
+		c.emit(code.OpEndTry)
+		if err := c.compileFinally(tries[i].finally); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileAssign(node *ast.AssignExpression) error {
+	op := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolveTarget(target.Value)
+		if op != "" {
+			c.loadSymbol(symbol)
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		if op != "" {
+			c.emit(binaryOperators[op])
+		}
+		c.assignSymbol(symbol)
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compile(target.Index); err != nil {
+			return err
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		if op == "" {
+			c.emit(code.OpSetIndex)
+		} else {
+			c.emit(code.OpIndexCompound, int(binaryOperators[op]))
+		}
+	default:
+		return c.errorf(CodeUnsupported, "cannot assign to %s", target.String())
+	}
+	return nil
+}
+
+func (c *Compiler) compileUpdate(node *ast.UpdateExpression) error {
+	op := code.OpAdd
+	if node.Operator == "--" {
+		op = code.OpSub
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolveTarget(target.Value)
+		c.loadSymbol(symbol)
+		if !node.Prefix {
+			c.emit(code.OpDup)
+		}
+		c.emit(code.OpUpdate, int(op))
+		c.assignSymbol(symbol)
+		if !node.Prefix {
+			c.emit(code.OpPop)
+		}
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compile(target.Index); err != nil {
+			return err
+		}
+		postfix := 0
+		if !node.Prefix {
+			postfix = 1
+		}
+		c.emit(code.OpIndexUpdate, int(op), postfix)
+	default:
+		return c.errorf(CodeUnsupported, "cannot assign to %s", target.String())
+	}
+	return nil
+}
+
+// loadName pushes a variable or a builtin. Names that are not defined
+// yet are globals, a function may use one that is defined after it and
+// the vm reports the ones that never are.
+func (c *Compiler) loadName(name string) {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		if _, ok := evaluator.LookupBuiltin(name); ok {
+			c.emit(code.OpGetBuiltin, c.addConstant(&object.String{Value: name}))
+			return
+		}
+		symbol = c.symbolTable.DefineGlobal(name)
+	}
+	c.loadSymbol(symbol)
+}
+
+// resolveTarget resolves the variable an assignment writes to, builtins
+// cannot be assigned so they get a slot that is never defined
+func (c *Compiler) resolveTarget(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+	if _, ok := evaluator.LookupBuiltin(name); ok {
+		return c.symbolTable.ReserveGlobal(name)
+	}
+	return c.symbolTable.DefineGlobal(name)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) assignSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpAssignGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpAssignLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpAssignFree, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction and maps it to the node being compiled
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	scope := c.scope()
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, code.Make(op, operands...)...)
+	scope.depth += stackEffect(op, operands)
+
+	if c.node != nil {
+		start, end := c.node.Pos(), c.node.End()
+		last := len(scope.sourceMap) - 1
+		if last < 0 || scope.sourceMap[last].Pos != start || scope.sourceMap[last].End != end {
+			scope.sourceMap = append(scope.sourceMap, object.SourcePos{Offset: pos, Pos: start, End: end})
+		}
+	}
+	return pos
+}
+
+// checkOperands records an error for operands too wide for the encoding
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	def, err := code.Lookup(byte(op))
+	if err != nil || c.err != nil {
+		return
+	}
+	for i, operand := range operands {
+		if operand >= 1<<(8*def.OperandWidths[i]) {
+			c.err = c.errorf(CodeTooLarge, "%s operand %d out of range, the code is too large", def.Name, operand)
+			return
+		}
+	}
+}
+
+// changeOperand patches the operand of the jump at pos
+func (c *Compiler) changeOperand(pos int, operand int) {
+	ins := c.currentInstructions()
+	op := code.Opcode(ins[pos])
+	c.checkOperands(op, operand)
+	copy(ins[pos:], code.Make(op, operand))
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) scope() *CompilationScope {
+	return &c.scopes[c.scopeIndex]
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+	c.scopes = c.scopes[:c.scopeIndex]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return scope
+}
+
+// enterBlock opens the scope of a for loop's variables
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+// leaveBlock clears the loop's local slots, closures created by a later
+// run of the loop must not share the variables of this one
+func (c *Compiler) leaveBlock() {
+	symbols := c.symbolTable.Symbols()
+	slices.SortFunc(symbols, func(a, b Symbol) int { return a.Index - b.Index })
+	for _, s := range symbols {
+		if s.Scope == LocalScope {
+			c.emit(code.OpUnsetLocal, s.Index)
+		}
+	}
+	c.symbolTable = c.symbolTable.Outer
+}
+
+func (c *Compiler) enterLoop() *loopScope {
+	scope := c.scope()
+	loop := &loopScope{depth: scope.depth, start: -1}
+	scope.loops = append(scope.loops, loop)
+	return loop
+}
+
+// leaveLoop points the pending continue and break jumps to their targets
+func (c *Compiler) leaveLoop(continueTarget, exit int) {
+	scope := c.scope()
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range loop.continues {
+		c.changeOperand(pos, continueTarget)
+	}
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, exit)
+	}
+}
+
+func (c *Compiler) errorf(code string, format string, a ...any) error {
+	return diagnostic.New(code, c.node.Pos(), c.node.End(), format, a...)
+}
+
+// stackEffect is how many values an instruction adds to the stack, for
+// jumps on the path that does not jump
+func stackEffect(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpConstant, code.OpDup, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin,
+		code.OpCellLocal, code.OpCellFree, code.OpImport:
+		return 1
+	case code.OpPop, code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterEqual, code.OpLessEqual,
+		code.OpJumpNotTruthy, code.OpJumpIfFalseOrPop, code.OpJumpIfTrueOrPop,
+		code.OpSetGlobal, code.OpSetLocal, code.OpIndex, code.OpIndexUpdate,
+		code.OpReturnValue, code.OpThrow:
+		return -1
+	case code.OpSetIndex, code.OpIndexCompound:
+		return -2
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return 1 - operands[0]
+	case code.OpClosure:
+		return 1 - operands[1]
+	case code.OpCall:
+		return -operands[0]
+	}
+	return 0
+}
@@ -0,0 +1,459 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/token"
+)
+
+// FormatVersion is the version of the compiled file layout. It changes
+// whenever the layout or the meaning of an opcode changes, files of
+// another version have to be compiled again.
+const FormatVersion = 1
+
+// Magic starts every compiled file
+const Magic = "MKC\x00"
+
+// ErrFormatVersion is returned when a compiled file has another version
+var ErrFormatVersion = errors.New("incompatible bytecode format version")
+
+// constant tags
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagFunction
+)
+
+// IsCompiled reports whether data starts like a compiled file
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// MarshalBinary encodes the bytecode as a compiled file. The layout is
+// the magic, the version and then the globals, the constants and the
+// main function. Integers are varints and strings are interned: a string
+// is written the first time it is used, later uses refer to it by index.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	e := &encoder{strings: map[string]int{}}
+	e.buf = append(e.buf, Magic...)
+	e.uint(FormatVersion)
+
+	e.uint(uint64(len(b.Globals)))
+	for _, name := range b.Globals {
+		e.string(name)
+	}
+
+	e.uint(uint64(len(b.Constants)))
+	for i, c := range b.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			e.buf = append(e.buf, tagInteger)
+			e.buf = binary.AppendVarint(e.buf, c.Value)
+		case *object.Float:
+			e.buf = append(e.buf, tagFloat)
+			e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(c.Value))
+		case *object.String:
+			e.buf = append(e.buf, tagString)
+			e.bytes([]byte(c.Value))
+		case *object.CompiledFunction:
+			e.buf = append(e.buf, tagFunction)
+			e.function(c)
+		default:
+			return nil, fmt.Errorf("constant %d: cannot encode %s", i, c.Type())
+		}
+	}
+
+	e.function(b.Main)
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a compiled file written by MarshalBinary and
+// checks that its instructions only refer to what exists
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	if !IsCompiled(data) {
+		return errors.New("not a compiled file")
+	}
+	d := &decoder{data: data[len(Magic):]}
+	if version := d.uint(); d.err == nil && version != FormatVersion {
+		return fmt.Errorf("%w: file has version %d, want %d, compile the script again", ErrFormatVersion, version, FormatVersion)
+	}
+
+	globals := make([]string, d.count())
+	for i := range globals {
+		globals[i] = d.string()
+	}
+
+	constants := make([]object.Object, d.count())
+	for i := range constants {
+		switch tag := d.byte(); tag {
+		case tagInteger:
+			constants[i] = &object.Integer{Value: d.int()}
+		case tagFloat:
+			constants[i] = &object.Float{Value: math.Float64frombits(d.uint64())}
+		case tagString:
+			constants[i] = &object.String{Value: string(d.bytes())}
+		case tagFunction:
+			constants[i] = d.function()
+		default:
+			d.fail("unknown constant tag %d", tag)
+		}
+	}
+
+	main := d.function()
+	if d.err == nil && len(d.data) != 0 {
+		d.fail("%d trailing bytes", len(d.data))
+	}
+	if d.err != nil {
+		return fmt.Errorf("malformed compiled file: %w", d.err)
+	}
+
+	for i, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := verify(fn, constants, len(globals)); err != nil {
+				return fmt.Errorf("malformed compiled file: constant %d: %w", i, err)
+			}
+		}
+	}
+	if len(main.FreeNames) != 0 {
+		return errors.New("malformed compiled file: main: free variables outside of a closure")
+	}
+	if err := verify(main, constants, len(globals)); err != nil {
+		return fmt.Errorf("malformed compiled file: main: %w", err)
+	}
+
+	b.Main, b.Constants, b.Globals = main, constants, globals
+	return nil
+}
+
+// verify checks that every instruction of fn is complete, that its
+// operands refer to existing constants, globals, locals, free variables
+// and operators, that a closure is made of the cells pushed right before
+// it and that its jumps land on an instruction. It does not follow the
+// values on the stack nor the try blocks: a file popping more than it
+// pushed, handing an instruction a value of the wrong type or ending a
+// try block it did not start still makes the vm panic, and the run of a
+// compiled file recovers from that.
+func verify(fn *object.CompiledFunction, constants []object.Object, globals int) error {
+	ins := fn.Instructions
+	starts := make(map[int]bool) // the offsets a jump may land on
+	var order []int              // the offsets of the instructions so far
+	var jumps [][2]int           // offset of a jump and its target
+	var last code.Opcode
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return fmt.Errorf("offset %d: %w", ip, err)
+		}
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if ip+1+width > len(ins) {
+			return fmt.Errorf("offset %d: truncated %s", ip, def.Name)
+		}
+		starts[ip] = true
+		last = code.Opcode(ins[ip])
+		operands, read := code.ReadOperands(def, ins[ip+1:])
+		switch last {
+		case code.OpConstant, code.OpClosure, code.OpGetBuiltin, code.OpImport:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("offset %d: constant %d out of range", ip, operands[0])
+			}
+			if err := verifyConstant(last, operands, constants[operands[0]]); err != nil {
+				return fmt.Errorf("offset %d: %w", ip, err)
+			}
+			if last == code.OpClosure {
+				if err := verifyCells(ins, order, ip, operands[1], starts); err != nil {
+					return fmt.Errorf("offset %d: %w", ip, err)
+				}
+			}
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpAssignGlobal:
+			if operands[0] >= globals {
+				return fmt.Errorf("offset %d: global %d out of range", ip, operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpAssignLocal, code.OpUnsetLocal, code.OpCellLocal:
+			if operands[0] >= fn.NumLocals {
+				return fmt.Errorf("offset %d: local %d out of range", ip, operands[0])
+			}
+		case code.OpGetFree, code.OpAssignFree, code.OpCellFree:
+			if operands[0] >= len(fn.FreeNames) {
+				return fmt.Errorf("offset %d: free variable %d out of range", ip, operands[0])
+			}
+		case code.OpUpdate, code.OpIndexUpdate:
+			if op := code.Opcode(operands[0]); op != code.OpAdd && op != code.OpSub {
+				return fmt.Errorf("offset %d: %s of opcode %d", ip, def.Name, operands[0])
+			}
+		case code.OpIndexCompound:
+			if !slices.Contains(slices.Collect(maps.Values(binaryOperators)), code.Opcode(operands[0])) {
+				return fmt.Errorf("offset %d: %s of opcode %d", ip, def.Name, operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpIfFalseOrPop, code.OpJumpIfTrueOrPop,
+			code.OpIterNext, code.OpTry:
+			jumps = append(jumps, [2]int{ip, operands[0]})
+		}
+		order = append(order, ip)
+		ip += 1 + read
+	}
+	for _, jump := range jumps {
+		if !starts[jump[1]] {
+			return fmt.Errorf("offset %d: jump target %d is not an instruction", jump[0], jump[1])
+		}
+	}
+	// the vm does not check for the end of the instructions, the last
+	// one must leave the function
+	if last != code.OpReturnValue {
+		return errors.New("function does not end with a return")
+	}
+	return nil
+}
+
+// verifyCells checks that the n instructions before the closure at ip
+// push its cells, a jump landing between them would skip some
+func verifyCells(ins code.Instructions, order []int, ip, n int, starts map[int]bool) error {
+	if n > len(order) {
+		return fmt.Errorf("closure of %d free variables after %d instructions", n, len(order))
+	}
+	for i, offset := range order[len(order)-n:] {
+		if op := code.Opcode(ins[offset]); op != code.OpCellLocal && op != code.OpCellFree {
+			return fmt.Errorf("free variable %d of the closure is not a cell", i)
+		}
+		if i > 0 {
+			starts[offset] = false
+		}
+	}
+	if n > 0 {
+		starts[ip] = false
+	}
+	return nil
+}
+
+// verifyConstant checks that the constant an instruction refers to has
+// the type the vm expects
+func verifyConstant(op code.Opcode, operands []int, constant object.Object) error {
+	switch op {
+	case code.OpClosure:
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			return fmt.Errorf("constant %d is not a function", operands[0])
+		}
+		if operands[1] != len(fn.FreeNames) {
+			return fmt.Errorf("closure of %d free variables gets %d", len(fn.FreeNames), operands[1])
+		}
+	case code.OpGetBuiltin, code.OpImport:
+		if _, ok := constant.(*object.String); !ok {
+			return fmt.Errorf("constant %d is not a string", operands[0])
+		}
+	}
+	return nil
+}
+
+type encoder struct {
+	buf     []byte
+	strings map[string]int
+}
+
+func (e *encoder) uint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	if i, ok := e.strings[s]; ok {
+		e.uint(uint64(i))
+		return
+	}
+	i := len(e.strings)
+	e.strings[s] = i
+	e.uint(uint64(i))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) strs(list []string) {
+	e.uint(uint64(len(list)))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) position(p token.Position) {
+	e.string(p.File)
+	e.uint(uint64(p.Offset))
+	e.uint(uint64(p.Line))
+	e.uint(uint64(p.Column))
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.bytes(fn.Instructions)
+	e.uint(uint64(fn.NumLocals))
+	e.uint(uint64(fn.NumParameters))
+	e.string(fn.Name)
+	e.strs(fn.LocalNames)
+	e.strs(fn.FreeNames)
+
+	e.uint(uint64(len(fn.SourceMap)))
+	for _, sp := range fn.SourceMap {
+		e.uint(uint64(sp.Offset))
+		e.position(sp.Pos)
+		e.position(sp.End)
+	}
+}
+
+// decoder reads what encoder wrote. The first error sticks, later reads
+// return zero values so callers only check err once at the end.
+type decoder struct {
+	data    []byte
+	strings []string
+	err     error
+}
+
+func (d *decoder) fail(format string, a ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, a...)
+	}
+	d.data = nil
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// count reads a length, which cannot be larger than the remaining data
+// since every element takes at least one byte
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.data)) {
+		d.fail("length %d exceeds the file", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.fail("unexpected end of file")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	if d.err != nil {
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	i := d.uint()
+	switch {
+	case d.err != nil:
+		return ""
+	case i < uint64(len(d.strings)):
+		return d.strings[i]
+	case i == uint64(len(d.strings)):
+		s := string(d.bytes())
+		d.strings = append(d.strings, s)
+		return s
+	default:
+		d.fail("string %d not defined yet", i)
+		return ""
+	}
+}
+
+func (d *decoder) strs() []string {
+	list := make([]string, d.count())
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) position() token.Position {
+	return token.Position{
+		File:   d.string(),
+		Offset: int(d.uint()),
+		Line:   int(d.uint()),
+		Column: int(d.uint()),
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Instructions: d.bytes(),
+		// the names follow, so a count larger than the rest of the
+		// file is wrong anyway
+		NumLocals:     d.count(),
+		NumParameters: d.count(),
+		Name:          d.string(),
+		LocalNames:    d.strs(),
+		FreeNames:     d.strs(),
+	}
+	fn.SourceMap = make([]object.SourcePos, d.count())
+	for i := range fn.SourceMap {
+		fn.SourceMap[i] = object.SourcePos{Offset: int(d.uint()), Pos: d.position(), End: d.position()}
+	}
+	switch {
+	case d.err != nil:
+	case fn.NumParameters > fn.NumLocals:
+		d.fail("function %q has more parameters than locals", fn.Name)
+	case fn.NumLocals > len(fn.LocalNames):
+		d.fail("function %q has more locals than names", fn.Name)
+	}
+	return fn
+}
@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let scale = 1.5;
+	let greet = fn(name) { "hello " + name };
+	let counter = fn() { let n = 0; fn() { n += 1; n * -3 } };
+	greet("world"); counter()() * scale`
+
+	c := New()
+	if err := c.Compile(parser.New(lexer.NewFile("main.mk", input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := c.Bytecode()
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+	if !IsCompiled(data) {
+		t.Fatalf("encoded bytecode does not start with the magic")
+	}
+
+	decoded := &Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %s", err)
+	}
+	if !slices.Equal(bytecode.Globals, decoded.Globals) {
+		t.Errorf("wrong globals. want=%v, got=%v", bytecode.Globals, decoded.Globals)
+	}
+	if len(bytecode.Constants) != len(decoded.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(decoded.Constants))
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			testSameFunction(t, fn, decoded.Constants[i])
+		} else if !reflect.DeepEqual(constant, decoded.Constants[i]) {
+			t.Errorf("constant %d differs. want=%+v, got=%+v", i, constant, decoded.Constants[i])
+		}
+	}
+	testSameFunction(t, bytecode.Main, decoded.Main)
+}
+
+func TestBytecodeRejectsBadFiles(t *testing.T) {
+	c := New()
+	if err := c.Compile(parse("let f = fn(x) { x + 1 }; f(2)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	data, err := c.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+
+	newer := append([]byte(Magic), byte(FormatVersion+1))
+	newer = append(newer, data[len(Magic)+1:]...)
+	err = (&Bytecode{}).UnmarshalBinary(newer)
+	if !errors.Is(err, ErrFormatVersion) {
+		t.Errorf("expected ErrFormatVersion. got=%v", err)
+	}
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled file"},
+		{data[:len(data)-3], "malformed compiled file"},
+		{append(append([]byte{}, data...), 0), "trailing bytes"},
+	}
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q. got=%v", tt.expected, err)
+		}
+	}
+}
+
+func testSameFunction(t *testing.T, expected *object.CompiledFunction, actual object.Object) {
+	t.Helper()
+	fn, ok := actual.(*object.CompiledFunction)
+	if !ok {
+		t.Errorf("object is not CompiledFunction. got=%T", actual)
+		return
+	}
+	if !slices.Equal(expected.Instructions, fn.Instructions) ||
+		expected.NumLocals != fn.NumLocals ||
+		expected.NumParameters != fn.NumParameters ||
+		expected.Name != fn.Name ||
+		!slices.Equal(expected.LocalNames, fn.LocalNames) ||
+		!slices.Equal(expected.FreeNames, fn.FreeNames) ||
+		!slices.Equal(expected.SourceMap, fn.SourceMap) {
+		t.Errorf("decoded function differs.\nwant=%+v\ngot=%+v", expected, fn)
+	}
+}
+
+func TestBytecodeRejectsBadInstructions(t *testing.T) {
+	inner := &object.CompiledFunction{
+		Instructions: slices.Concat(code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)),
+		FreeNames:    []string{"x"},
+	}
+	constants := []object.Object{&object.Integer{Value: 1}, inner}
+
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{[]code.Instructions{code.Make(code.OpJump, 7448), code.Make(code.OpReturnValue)}, "offset 0: jump target 7448 is not an instruction"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpJumpNotTruthy, 1), code.Make(code.OpReturnValue)}, "offset 3: jump target 1 is not an instruction"},
+		{[]code.Instructions{code.Make(code.OpGetGlobal, 7448), code.Make(code.OpReturnValue)}, "offset 0: global 7448 out of range"},
+		{[]code.Instructions{code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue)}, "offset 0: free variable 0 out of range"},
+		{[]code.Instructions{code.Make(code.OpClosure, 0, 0), code.Make(code.OpReturnValue)}, "offset 0: constant 0 is not a function"},
+		{[]code.Instructions{code.Make(code.OpClosure, 1, 0), code.Make(code.OpReturnValue)}, "offset 0: closure of 1 free variables gets 0"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpClosure, 1, 1), code.Make(code.OpReturnValue)}, "offset 3: free variable 0 of the closure is not a cell"},
+		{[]code.Instructions{code.Make(code.OpClosure, 1, 1), code.Make(code.OpReturnValue)}, "offset 0: closure of 1 free variables after 0 instructions"},
+		{[]code.Instructions{code.Make(code.OpGetGlobal, 0), code.Make(code.OpUpdate, int(code.OpMul)), code.Make(code.OpReturnValue)}, fmt.Sprintf("offset 3: OpUpdate of opcode %d", code.OpMul)},
+		{[]code.Instructions{code.Make(code.OpIndexCompound, 255), code.Make(code.OpReturnValue)}, "offset 0: OpIndexCompound of opcode 255"},
+		{[]code.Instructions{code.Make(code.OpGetBuiltin, 0), code.Make(code.OpReturnValue)}, "offset 0: constant 0 is not a string"},
+		{[]code.Instructions{code.Make(code.OpConstant, 0)}, "function does not end with a return"},
+	}
+	for _, tt := range tests {
+		bytecode := &Bytecode{
+			Main:      &object.CompiledFunction{Instructions: slices.Concat(tt.instructions...)},
+			Constants: constants,
+			Globals:   []string{"args"},
+		}
+		data, err := bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %s", err)
+		}
+		err = (&Bytecode{}).UnmarshalBinary(data)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("expected error ending with %q. got=%v", tt.expected, err)
+		}
+	}
+
+	bytecode := &Bytecode{
+		Main: &object.CompiledFunction{Instructions: code.Make(code.OpReturnValue)},
+		Constants: []object.Object{&object.CompiledFunction{
+			Instructions:  code.Make(code.OpReturnValue),
+			NumLocals:     1,
+			NumParameters: 2,
+			Name:          "f",
+			LocalNames:    []string{"a", "b"},
+		}},
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+	err = (&Bytecode{}).UnmarshalBinary(data)
+	if expected := `function "f" has more parameters than locals`; err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q. got=%v", expected, err)
+	}
+}
@@ -0,0 +1,119 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+// Symbol is a resolved variable, Index is its slot in the globals, in
+// the frame's locals or in the closure's free variables
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable resolves names for one scope. Function tables own the
+// local slots of a call frame, block tables (for the loops) hand out
+// slots of the function they are nested in, so a name defined in a loop
+// is not visible after it.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store       map[string]Symbol
+	function    *SymbolTable // the table that owns the slots, itself for functions
+	names       []string     // slot names, for runtime errors
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol)}
+	s.function = s
+	return s
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol), Outer: outer}
+	s.function = outer.function
+	return s
+}
+
+// Define binds name in this scope. Like `let` in the evaluator,
+// defining a name twice in the same scope reuses its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope != FreeScope {
+		return symbol
+	}
+	fn := s.function
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: len(fn.names)}
+	if fn.Outer == nil {
+		symbol.Scope = GlobalScope
+	}
+	fn.names = append(fn.names, name)
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineGlobal binds name in the outermost scope
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s.Define(name)
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || s.function != s || symbol.Scope == GlobalScope {
+		return symbol, ok
+	}
+	// a local of an enclosing function is captured by this one
+	return s.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Names returns the names of the slots owned by the table's function,
+// indexed like the slots
+func (s *SymbolTable) Names() []string {
+	return s.function.names
+}
+
+// Symbols returns the symbols defined directly in this scope
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		if symbol.Scope != FreeScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// ReserveGlobal allocates a global slot for name without binding it
+func (s *SymbolTable) ReserveGlobal(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	s.names = append(s.names, name)
+	return Symbol{Name: name, Scope: GlobalScope, Index: len(s.names) - 1}
+}
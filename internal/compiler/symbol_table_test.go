@@ -0,0 +1,63 @@
+package compiler
+
+import "testing"
+
+func TestResolveScopes(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+
+	outer := NewEnclosedSymbolTable(global)
+	b := outer.Define("b")
+
+	loop := NewBlockSymbolTable(outer)
+	c := loop.Define("c")
+
+	inner := NewEnclosedSymbolTable(loop)
+	d := inner.Define("d")
+
+	expected := []struct {
+		table  *SymbolTable
+		name   string
+		symbol Symbol
+	}{
+		{inner, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{inner, "b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{inner, "c", Symbol{Name: "c", Scope: FreeScope, Index: 1}},
+		{inner, "d", Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+		{loop, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{loop, "c", Symbol{Name: "c", Scope: LocalScope, Index: 1}},
+	}
+	if a.Scope != GlobalScope || b.Index != 0 || c.Index != 1 || d.Index != 0 {
+		t.Fatalf("wrong definitions: %+v %+v %+v %+v", a, b, c, d)
+	}
+
+	for _, tt := range expected {
+		result, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.symbol {
+			t.Errorf("expected %s to resolve to %+v. got=%+v", tt.name, tt.symbol, result)
+		}
+	}
+
+	if len(inner.FreeSymbols) != 2 || inner.FreeSymbols[1] != c {
+		t.Errorf("wrong free symbols: %+v", inner.FreeSymbols)
+	}
+	if _, ok := outer.Resolve("c"); ok {
+		t.Errorf("loop variable c visible outside the loop")
+	}
+}
+
+func TestDefineTwiceReusesSlot(t *testing.T) {
+	global := NewSymbolTable()
+	first := global.Define("x")
+	global.Define("y")
+	if second := global.Define("x"); second != first {
+		t.Errorf("redefinition got a new slot. first=%+v, second=%+v", first, second)
+	}
+	if names := global.Names(); len(names) != 2 || names[0] != "x" || names[1] != "y" {
+		t.Errorf("wrong slot names: %v", names)
+	}
+}
@@ -0,0 +1,210 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Span is the source range a diagnostic refers to, End is exclusive
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Related points at another location that helps explaining a diagnostic
+type Related struct {
+	Span    Span
+	Message string
+}
+
+// StackFrame is a function call that was running when a runtime error
+// was raised
+type StackFrame struct {
+	Function string // the name the function was bound to, or <anonymous>
+	Call     Span   // the call expression that started the call
+}
+
+// Diagnostic is a problem found in the source by the parser or the evaluator
+type Diagnostic struct {
+	Severity Severity
+	Code     string // short stable identifier like P001, empty if none
+	Message  string
+	Span     Span
+	Hints    []string
+	Related  []Related
+	Stack    []StackFrame // calls of a runtime error, innermost first
+}
+
+// New creates an error diagnostic covering the given span
+func New(code string, start, end token.Position, format string, a ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     Span{Start: start, End: end},
+	}
+}
+
+// Hint appends a hint and returns d so it can be chained after New
+func (d *Diagnostic) Hint(format string, a ...any) *Diagnostic {
+	d.Hints = append(d.Hints, fmt.Sprintf(format, a...))
+	return d
+}
+
+// Error formats the diagnostic on a single line as pos: message
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+func (d *Diagnostic) String() string {
+	return d.Error()
+}
+
+// Render writes the diagnostic followed by the offending source line
+// with the span underlined, src is the source the positions refer to.
+//
+//	error[P001]: expected next token to be =. got=INT
+//	 --> main.mk:1:7
+//	  |
+//	1 | let x 5;
+//	  |       ^
+//	  = hint: ...
+//	  = stack trace:
+//	      at inner (main.mk:1:7)
+//	      at <main> (main.mk:3:1)
+func Render(out io.Writer, src string, d *Diagnostic) {
+	header := d.Severity.String()
+	if d.Code != "" {
+		header += "[" + d.Code + "]"
+	}
+	fmt.Fprintf(out, "%s: %s\n", header, d.Message)
+
+	gutter := renderSnippet(out, src, d.Span)
+	for _, r := range d.Related {
+		fmt.Fprintf(out, "%s = note: %s\n", gutter, r.Message)
+		renderSnippet(out, src, r.Span)
+	}
+	for _, h := range d.Hints {
+		fmt.Fprintf(out, "%s = hint: %s\n", gutter, h)
+	}
+	renderStack(out, gutter, d)
+}
+
+// frames shown at each end of a long stack trace
+const stackEdge = 10
+
+// renderStack prints where each function of the stack was when the error
+// was raised, like a traceback: the innermost is at the error and every
+// other one at the call of the function above it
+func renderStack(out io.Writer, gutter string, d *Diagnostic) {
+	if len(d.Stack) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "%s = stack trace:\n", gutter)
+	trace := d.Trace()
+	for i, line := range trace {
+		if i == stackEdge && len(trace) > 2*stackEdge+1 {
+			fmt.Fprintf(out, "%s     ... %d more calls\n", gutter, len(trace)-1-2*stackEdge)
+		}
+		if i < stackEdge || i >= len(trace)-1-stackEdge {
+			fmt.Fprintf(out, "%s     at %s\n", gutter, line)
+		}
+	}
+}
+
+// Trace lists the functions of the stack as "name (position)" innermost
+// first, ending with <main>
+func (d *Diagnostic) Trace() []string {
+	trace := make([]string, 0, len(d.Stack)+1)
+	pos := d.Span.Start
+	for _, frame := range d.Stack {
+		trace = append(trace, fmt.Sprintf("%s (%s)", frame.Function, pos))
+		pos = frame.Call.Start
+	}
+	return append(trace, fmt.Sprintf("<main> (%s)", pos))
+}
+
+// RenderAll renders every diagnostic in order
+func RenderAll(out io.Writer, src string, diags []*Diagnostic) {
+	for _, d := range diags {
+		Render(out, src, d)
+	}
+}
+
+// renderSnippet prints the location and the source line of span and
+// returns the blank gutter used so callers can align follow-up lines
+func renderSnippet(out io.Writer, src string, span Span) string {
+	start := span.Start
+	if !start.IsValid() {
+		return " "
+	}
+	lineNo := fmt.Sprintf("%d", start.Line)
+	gutter := strings.Repeat(" ", len(lineNo))
+
+	fmt.Fprintf(out, "%s--> %s\n", gutter, start)
+
+	line, ok := sourceLine(src, start.Line)
+	if !ok {
+		return gutter
+	}
+	fmt.Fprintf(out, "%s |\n", gutter)
+	fmt.Fprintf(out, "%s | %s\n", lineNo, line)
+
+	// keep tabs in the padding so the carets line up with the source,
+	// columns count chars so the line is walked by rune
+	chars := []rune(line)
+	var pad strings.Builder
+	for i := 0; i < start.Column-1 && i < len(chars); i++ {
+		if chars[i] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	width := 1
+	if span.End.Line == start.Line && span.End.Column > start.Column {
+		width = span.End.Column - start.Column
+	} else if span.End.Line > start.Line && len(chars) >= start.Column {
+		width = len(chars) - start.Column + 1
+	}
+	fmt.Fprintf(out, "%s | %s%s\n", gutter, pad.String(), strings.Repeat("^", width))
+
+	return gutter
+}
+
+// sourceLine returns the line of src numbered line, there is none when
+// the source is unknown
+func sourceLine(src string, line int) (string, bool) {
+	if src == "" {
+		return "", false
+	}
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
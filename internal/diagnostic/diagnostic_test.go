@@ -0,0 +1,147 @@
+package diagnostic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/token"
+)
+
+func TestRender(t *testing.T) {
+	src := "let x = 1;\n\tlet y = x + z;"
+	d := New("R001",
+		token.Position{File: "main.mk", Offset: 23, Line: 2, Column: 14},
+		token.Position{File: "main.mk", Offset: 24, Line: 2, Column: 15},
+		"identifier not found: %s", "z",
+	).Hint("declare it with let before using it")
+
+	var out bytes.Buffer
+	Render(&out, src, d)
+
+	expected := "error[R001]: identifier not found: z\n" +
+		" --> main.mk:2:14\n" +
+		"  |\n" +
+		"2 | \tlet y = x + z;\n" +
+		"  | \t            ^\n" +
+		"  = hint: declare it with let before using it\n"
+
+	if out.String() != expected {
+		t.Errorf("render wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+// a compiled file whose script is gone only has the position
+func TestRenderWithoutSource(t *testing.T) {
+	d := New("R001",
+		token.Position{File: "main.mk", Offset: 23, Line: 1, Column: 17},
+		token.Position{File: "main.mk", Offset: 28, Line: 1, Column: 22},
+		"division by zero",
+	)
+
+	var out bytes.Buffer
+	Render(&out, "", d)
+
+	expected := "error[R001]: division by zero\n" +
+		" --> main.mk:1:17\n"
+
+	if out.String() != expected {
+		t.Errorf("render wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRenderUnicodeLine(t *testing.T) {
+	src := `let größe = "çà" + 1.5;`
+	d := New("R001",
+		token.Position{Offset: 15, Line: 1, Column: 13},
+		token.Position{Offset: 28, Line: 1, Column: 23},
+		"type mismatch: STRING + FLOAT",
+	)
+
+	var out bytes.Buffer
+	Render(&out, src, d)
+
+	expected := "error[R001]: type mismatch: STRING + FLOAT\n" +
+		" --> 1:13\n" +
+		"  |\n" +
+		"1 | let größe = \"çà\" + 1.5;\n" +
+		"  |             ^^^^^^^^^^\n"
+
+	if out.String() != expected {
+		t.Errorf("render wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRenderMultiColumnSpan(t *testing.T) {
+	src := "len(1)"
+	d := &Diagnostic{
+		Severity: Warning,
+		Message:  "suspicious call",
+		Span: Span{
+			Start: token.Position{Line: 1, Column: 1},
+			End:   token.Position{Line: 1, Column: 7},
+		},
+	}
+
+	var out bytes.Buffer
+	Render(&out, src, d)
+
+	expected := "warning: suspicious call\n" +
+		" --> 1:1\n" +
+		"  |\n" +
+		"1 | len(1)\n" +
+		"  | ^^^^^^\n"
+
+	if out.String() != expected {
+		t.Errorf("render wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+	if d.Error() != "1:1: suspicious call" {
+		t.Errorf("d.Error() wrong. got=%q", d.Error())
+	}
+}
+
+func TestRenderStack(t *testing.T) {
+	src := "let inner = fn() { 1 + true };\nlet outer = fn() { inner() };\nouter();"
+	pos := func(line, col int) token.Position {
+		return token.Position{File: "main.mk", Line: line, Column: col}
+	}
+	d := New("R001", pos(1, 20), pos(1, 28), "type mismatch: INTEGER + BOOLEAN")
+	d.Stack = []StackFrame{
+		{Function: "inner", Call: Span{Start: pos(2, 20), End: pos(2, 27)}},
+		{Function: "outer", Call: Span{Start: pos(3, 1), End: pos(3, 8)}},
+	}
+
+	var out bytes.Buffer
+	Render(&out, src, d)
+
+	expected := "error[R001]: type mismatch: INTEGER + BOOLEAN\n" +
+		" --> main.mk:1:20\n" +
+		"  |\n" +
+		"1 | let inner = fn() { 1 + true };\n" +
+		"  |                    ^^^^^^^^\n" +
+		"  = stack trace:\n" +
+		"      at inner (main.mk:1:20)\n" +
+		"      at outer (main.mk:2:20)\n" +
+		"      at <main> (main.mk:3:1)\n"
+
+	if out.String() != expected {
+		t.Errorf("render wrong.\nexpected=%q\ngot=     %q", expected, out.String())
+	}
+}
+
+func TestRenderLongStack(t *testing.T) {
+	d := New("R002", token.Position{Line: 1, Column: 16}, token.Position{Line: 1, Column: 19}, "maximum call depth of 30 exceeded")
+	for range 30 {
+		d.Stack = append(d.Stack, StackFrame{Function: "f", Call: Span{Start: token.Position{Line: 1, Column: 16}}})
+	}
+
+	var out bytes.Buffer
+	Render(&out, "", d)
+
+	if !strings.Contains(out.String(), "... 10 more calls\n") {
+		t.Errorf("long stack not shortened. got=%q", out.String())
+	}
+	if lines := strings.Count(out.String(), " at "); lines != 2*stackEdge+1 {
+		t.Errorf("wrong number of frames rendered. got=%d", lines)
+	}
+}
@@ -3,19 +3,35 @@ package evaluator
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/assimad8/go-interpreter/internal/object"
 )
 
-var builtins = map[string]*object.Builtin{
+// Builtin is a builtin function of the language, unlike the builtins of
+// a host it gets the evaluator running it so what it allocates is
+// charged against the memory limit
+type Builtin struct {
+	Fn func(e *Evaluator,args ...object.Object) object.Object
+}
+
+func (b *Builtin) Type() object.ObjectType {
+	return object.BUILTIN_OBJ
+}
+func (b *Builtin) Inspect() string {
+	return "builtin function"
+}
+
+var builtins = map[string]*Builtin{
 	"len": {
-		Fn:func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args)!=1{
 				return newError("wrong number of arguments. got=%d, want=1",len(args))
 			}
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// in chars, bytes gives the encoded length
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
 			default:
@@ -24,7 +40,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"first": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",len(args))
 			}
@@ -40,7 +56,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",len(args))
 			}
@@ -56,7 +72,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",len(args))
 			}
@@ -67,15 +83,18 @@ var builtins = map[string]*object.Builtin{
 			arg := args[0].(*object.Array)
 			length := len(arg.Elements)
 			if length >0 {
+				if errObj := e.alloc(arraySize(length-1)); errObj != nil {
+					return errObj
+				}
 				newArray := make([]object.Object,length-1)
-				copy(newArray,arg.Elements[:length])
+				copy(newArray,arg.Elements[1:length])
 				return &object.Array{Elements: newArray}
 			}
 			return NULL
 		},
 	},
 	"push": {
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",len(args))
 			}
@@ -84,6 +103,9 @@ var builtins = map[string]*object.Builtin{
 			}
 			arg := args[0].(*object.Array)
 			length := len(arg.Elements)
+			if errObj := e.alloc(arraySize(length+1)); errObj != nil {
+				return errObj
+			}
 			newArray := make([]object.Object,length+1)
 			copy(newArray,arg.Elements)
 			newArray[length] = args[1]
@@ -91,7 +113,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"puts": {
-		Fn:func(args ...object.Object) object.Object {
+		Fn: func(e *Evaluator,args ...object.Object) object.Object {
 			if len(args)<1 {
 				return newError("wrong number of arguments. got=%d, want>=1",len(args))
 			}
@@ -99,8 +121,16 @@ var builtins = map[string]*object.Builtin{
 			for _,arg := range args {
 				data = append(data,arg.Inspect())
 			}
-			fmt.Println(strings.Join(data," "))
+			fmt.Fprintln(e.opts.Stdout,strings.Join(data," "))
 			return NULL
 		},
 	},
-}
\ No newline at end of file
+}
+
+func init() {
+	for _,library := range []map[string]*Builtin{stringBuiltins,collectionBuiltins,hashBuiltins} {
+		for name,builtin := range library {
+			builtins[name] = builtin
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package evaluator
+
+import (
+	"math"
+	"slices"
+
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// collectionBuiltins build their results in one pass instead of copying
+// the array for every element like rest and push do. The functions they
+// take are called through callFunction so they work on both engines.
+var collectionBuiltins = map[string]*Builtin{
+	"map": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("map", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			elements := args[0].(*object.Array).Elements
+			if errObj := e.alloc(arraySize(len(elements))); errObj != nil {
+				return errObj
+			}
+			result := make([]object.Object, len(elements))
+			for i, el := range elements {
+				val := e.callFunction(args[1], el)
+				if isError(val) {
+					return val
+				}
+				result[i] = val
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"filter": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("filter", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			var result []object.Object
+			for _, el := range args[0].(*object.Array).Elements {
+				keep := e.callFunction(args[1], el)
+				if isError(keep) {
+					return keep
+				}
+				if isTruthy(keep) {
+					result = append(result, el)
+				}
+			}
+			return e.newArray(result)
+		},
+	},
+	"reduce": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("reduce", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ, ""); errObj != nil {
+				return errObj
+			}
+			elements := args[0].(*object.Array).Elements
+			var acc object.Object
+			if len(args) == 3 {
+				acc = args[2]
+			} else if len(elements) == 0 {
+				return newError("reduce of an empty array with no initial value")
+			} else {
+				acc, elements = elements[0], elements[1:]
+			}
+			for _, el := range elements {
+				acc = e.callFunction(args[1], acc, el)
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	},
+	"each": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("each", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			for _, el := range args[0].(*object.Array).Elements {
+				if val := e.callFunction(args[1], el); isError(val) {
+					return val
+				}
+			}
+			return NULL
+		},
+	},
+	"find": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("find", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			for _, el := range args[0].(*object.Array).Elements {
+				found := e.callFunction(args[1], el)
+				if isError(found) {
+					return found
+				}
+				if isTruthy(found) {
+					return el
+				}
+			}
+			return NULL
+		},
+	},
+	"any": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("any", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			for _, el := range args[0].(*object.Array).Elements {
+				val := e.callFunction(args[1], el)
+				if isError(val) {
+					return val
+				}
+				if isTruthy(val) {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+	},
+	"all": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("all", args, 2, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			for _, el := range args[0].(*object.Array).Elements {
+				val := e.callFunction(args[1], el)
+				if isError(val) {
+					return val
+				}
+				if !isTruthy(val) {
+					return FALSE
+				}
+			}
+			return TRUE
+		},
+	},
+	"sort": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("sort", args, 1, object.ARRAY_OBJ, object.FUNCTION_OBJ); errObj != nil {
+				return errObj
+			}
+			if errObj := e.alloc(arraySize(len(args[0].(*object.Array).Elements))); errObj != nil {
+				return errObj
+			}
+			elements := args[0].(*object.Array).Elements
+			// the positions are sorted rather than the elements, so two
+			// elements that cannot be compared are named in their order
+			positions := make([]int, len(elements))
+			for i := range positions {
+				positions[i] = i
+			}
+			var errObj object.Object
+			// the first error stops the calls, the order left behind
+			// does not matter since the result is dropped
+			slices.SortStableFunc(positions, func(i, j int) int {
+				if errObj != nil {
+					return 0
+				}
+				a, b := elements[i], elements[j]
+				if len(args) == 1 {
+					if i > j {
+						return -e.compare(b, a, &errObj)
+					}
+					return e.compare(a, b, &errObj)
+				}
+				order := e.callFunction(args[1], a, b)
+				if n, ok := order.(*object.Integer); ok {
+					return int(max(min(n.Value, 1), -1))
+				}
+				if isError(order) {
+					errObj = order
+				} else {
+					errObj = newError("comparator of 'sort' must return INTEGER. got=%s", order.Type())
+				}
+				return 0
+			})
+			if errObj != nil {
+				return errObj
+			}
+			result := make([]object.Object, len(positions))
+			for k, i := range positions {
+				result[k] = elements[i]
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"reverse": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("reverse", args, 1, object.ARRAY_OBJ); errObj != nil {
+				return errObj
+			}
+			result := slices.Clone(args[0].(*object.Array).Elements)
+			slices.Reverse(result)
+			return e.newArray(result)
+		},
+	},
+	"zip": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("zip", args, 2, object.ARRAY_OBJ, object.ARRAY_OBJ); errObj != nil {
+				return errObj
+			}
+			left, right := args[0].(*object.Array).Elements, args[1].(*object.Array).Elements
+			n := min(len(left), len(right))
+			if errObj := e.alloc(arraySize(n) + int64(n)*arraySize(2)); errObj != nil {
+				return errObj
+			}
+			result := make([]object.Object, n)
+			for i := range result {
+				result[i] = &object.Array{Elements: []object.Object{left[i], right[i]}}
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"range": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("range", args, 1, object.INTEGER_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); errObj != nil {
+				return errObj
+			}
+			start, stop, step := int64(0), args[0].(*object.Integer).Value, int64(1)
+			if len(args) > 1 {
+				start, stop = stop, args[1].(*object.Integer).Value
+			}
+			if len(args) > 2 {
+				step = args[2].(*object.Integer).Value
+			}
+			if step == 0 {
+				return newError("step of 'range' must not be 0")
+			}
+			// the distance as unsigned does not overflow
+			var n uint64
+			if step > 0 && stop > start {
+				n = ceilDiv(uint64(stop-start), uint64(step))
+			} else if step < 0 && stop < start {
+				n = ceilDiv(uint64(start-stop), uint64(-step))
+			}
+			if n > math.MaxInt/valueSize {
+				return newError("range too large: %d elements", n)
+			}
+			if errObj := e.alloc(arraySize(int(n))); errObj != nil {
+				return errObj
+			}
+			result := make([]object.Object, n)
+			for i := range result {
+				result[i] = &object.Integer{Value: start + int64(i)*step}
+			}
+			return &object.Array{Elements: result}
+		},
+	},
+	"flatten": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("flatten", args, 1, object.ARRAY_OBJ, object.INTEGER_OBJ); errObj != nil {
+				return errObj
+			}
+			depth := int64(1)
+			if len(args) == 2 {
+				depth = args[1].(*object.Integer).Value
+			}
+			arr := args[0].(*object.Array)
+			result, errObj := flatten(nil, arr.Elements, depth, map[*object.Array]bool{arr: true})
+			if errObj != nil {
+				return errObj
+			}
+			return e.newArray(result)
+		},
+	},
+	"unique": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("unique", args, 1, object.ARRAY_OBJ); errObj != nil {
+				return errObj
+			}
+			seen := map[object.HashKey]bool{}
+			var result []object.Object
+		elements:
+			for _, el := range args[0].(*object.Array).Elements {
+				if key, ok := el.(object.Hashable); ok {
+					if seen[key.HashKey()] {
+						continue
+					}
+					seen[key.HashKey()] = true
+				} else {
+					// values that are not hash keys are compared one by one
+					for _, kept := range result {
+						if objectsEqual(el, kept) {
+							continue elements
+						}
+					}
+				}
+				result = append(result, el)
+			}
+			return e.newArray(result)
+		},
+	},
+}
+
+// newArray charges elements against the memory limit and wraps them,
+// for results whose size is only known once they are built
+func (e *Evaluator) newArray(elements []object.Object) object.Object {
+	if errObj := e.alloc(arraySize(len(elements))); errObj != nil {
+		return errObj
+	}
+	if elements == nil {
+		elements = []object.Object{}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// compare orders a and b with < for sort, the first error is kept in
+// errObj
+func (e *Evaluator) compare(a, b object.Object, errObj *object.Object) int {
+	for _, op := range []string{"<", ">"} {
+		result := e.evalInfixExpression(op, a, b)
+		if isError(result) {
+			*errObj = result
+			return 0
+		}
+		if result == TRUE {
+			if op == "<" {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func ceilDiv(a, b uint64) uint64 {
+	n := a / b
+	if a%b != 0 {
+		n++
+	}
+	return n
+}
+
+// flatten appends the elements to result, splicing in the nested arrays
+// down to depth. path holds the arrays being spliced, meeting one of them
+// again means an array contains itself and would never end.
+func flatten(result, elements []object.Object, depth int64, path map[*object.Array]bool) ([]object.Object, *object.Error) {
+	for _, el := range elements {
+		arr, ok := el.(*object.Array)
+		if !ok || depth <= 0 {
+			result = append(result, el)
+			continue
+		}
+		if path[arr] {
+			return nil, newError("cannot flatten an array that contains itself")
+		}
+		path[arr] = true
+		var errObj *object.Error
+		result, errObj = flatten(result, arr.Elements, depth-1, path)
+		if errObj != nil {
+			return nil, errObj
+		}
+		delete(path, arr)
+	}
+	return result, nil
+}
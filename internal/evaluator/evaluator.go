@@ -1,10 +1,18 @@
 package evaluator
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/module"
 	"github.com/assimad8/go-interpreter/internal/object"
 )
 
@@ -13,101 +21,644 @@ var (
 	NULL  = &object.NULL{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// DefaultMaxDepth is the call depth allowed when Options.MaxDepth is 0,
+// it stays well below what the Go stack can hold
+const DefaultMaxDepth = 10000
+
+// MaxNesting bounds the nodes being evaluated at once, the nodes of the
+// running calls included. Function calls alone stop at MaxDepth, this
+// stops trees nested deeply inside each call before the Go stack runs out.
+const MaxNesting = 200000
+
+// the context is polled once every that many steps
+const contextCheckInterval = 1024
+
+// Options bound an evaluation, a script exceeding them stops with an
+// error instead of hanging or crashing the process
+type Options struct {
+	Context  context.Context // stops the evaluation when done, may be nil
+	MaxDepth int             // nested function calls, DefaultMaxDepth if 0
+	MaxSteps int64           // evaluated nodes, unlimited if 0
+	// bytes of strings, arrays and hashes created, unlimited if 0. The
+	// total of every allocation is counted, values are never released.
+	MaxMemory int64
+	// loads the imported modules, a loader without search path if nil
+	Modules *module.Loader
+	Stdout  io.Writer // where puts writes, os.Stdout if nil
+}
+
+// Evaluator walks the AST. The step budget covers everything it
+// evaluates, so use a new one for each run.
+type Evaluator struct {
+	opts      Options
+	steps     int64
+	nesting   int                     // nodes being evaluated, see MaxNesting
+	calls     []diagnostic.StackFrame // the running calls, outermost first
+	allocated int64
+	halt      *object.Error // set once a limit is hit, every step then fails
 
+	// the call of the running builtin, and how it calls back the functions
+	// of another engine
+	builtinCall ast.Node
+	callback    func(fn object.Object,args []object.Object) object.Object
+}
+
+func New(opts Options) *Evaluator {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+	if opts.Modules == nil {
+		opts.Modules = module.NewLoader(nil)
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	return &Evaluator{opts: opts}
+}
+
+// Eval evaluates node with the default options
 func Eval(node ast.Node,env *object.Environment) object.Object {
+	return New(Options{}).Eval(node,env)
+}
+
+func (e *Evaluator) Eval(node ast.Node,env *object.Environment) object.Object {
+	var result object.Object
+	if errObj := e.step(); errObj != nil {
+		result = errObj
+	}else if e.nesting >= MaxNesting {
+		result = e.stop(object.CodeNesting,"maximum nesting depth of %d exceeded",MaxNesting)
+	}else {
+		e.nesting++
+		result = e.eval(node,env)
+		e.nesting--
+	}
+	// the innermost node an error comes from gives it its position,
+	// the calls running at that point are its stack
+	if err,ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+		err.End = node.End()
+		err.Stack = e.stack()
+	}
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node,env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements,env)
+		return e.evalProgram(node.Statements,env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression,env)
+		return e.Eval(node.Expression,env)
 	//Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value:node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value:node.Value}
 	case *ast.PrefixExpression:
-		right := Eval(node.Right,env)
+		right := e.Eval(node.Right,env)
 		if isError(right){
 			return right
 		}
 		return evalPrefixExpression(node.Operator,right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left,env)
+		left := e.Eval(node.Left,env)
 		if isError(left){
 			return left
 		}
-		right := Eval(node.Right,env)
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node.Operator,left,node.Right,env)
+		}
+		right := e.Eval(node.Right,env)
 		if isError(right){
 			return right
 		}
-		return evalInfixExpression(node.Operator,left,right)
+		return e.evalInfixExpression(node.Operator,left,right)
 	case *ast.Boolean:
 		if node.Value {
 			return TRUE
 		}
 		return FALSE
 	case *ast.BlockStatement:
-		return evalBlockStatement(node.Statements,env)
+		return e.evalBlockStatement(node.Statements,env)
 	case *ast.IfExpression:
-		return evalIfExpression(node,env)
+		return e.evalIfExpression(node,env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue,env)
+		val := e.Eval(node.ReturnValue,env)
 		if isError(val){
 			return val
 		}
 		return &object.ReturnVALUE{Value:val}
+	case *ast.WhileStatement:
+		return e.evalWhileStatement(node,env)
+	case *ast.ForInStatement:
+		return e.evalForInStatement(node,env)
+	case *ast.ForStatement:
+		return e.evalForStatement(node,env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node,env)
+	case *ast.ExportStatement:
+		return e.Eval(node.Statement,env)
+	case *ast.TryStatement:
+		return e.evalTryStatement(node,env)
+	case *ast.ThrowStatement:
+		val := e.Eval(node.Value,env)
+		if isError(val){
+			return val
+		}
+		return throw(val)
 	case *ast.LetStatement:
-		val := Eval(node.Value,env)
+		val := e.Eval(node.Value,env)
 		if isError(val){
 			return val
 		}
+		// like the compiler, only a function literal is named after the
+		// binding
+		if fn,ok := val.(*object.Function); ok {
+			if _,ok := node.Value.(*ast.FunctionLiteral); ok {
+				fn.Name = node.Name.Value
+			}
+		}
 		env.Set(node.Name.Value,val)
 	case *ast.Identifier:
 		return evalIdentifier(node,env)
 	case *ast.FunctionLiteral:
 		parameters := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: parameters,Body: body}
+		// the function keeps the environment it is defined in so it can
+		// see the outer bindings when it is called later
+		return &object.Function{Parameters: parameters,Body: body,Env: env}
 	case *ast.CallExpression:
-		function := Eval(node.Function,env)
+		function := e.Eval(node.Function,env)
 		if isError(function){
 			return function
 		}
-		args := evalExpressions(node.Arguments,env)
+		args := e.evalExpressions(node.Arguments,env)
 		if len(args) == 1 && isError(args[0]){
 			return args[0]
 		}
-		return applyFunction(function,args)
+		return e.applyFunction(function,args,node)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		parts := []object.Object{}
+		for i,text := range node.Texts {
+			parts = append(parts,&object.String{Value: text})
+			if i < len(node.Exprs) {
+				val := e.Eval(node.Exprs[i],env)
+				if isError(val) {
+					return val
+				}
+				parts = append(parts,val)
+			}
+		}
+		return e.interpolate(parts)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements,env)
+		elements := e.evalExpressions(node.Elements,env)
 		if len(elements)==1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if errObj := e.alloc(arraySize(len(elements))); errObj != nil {
+			return errObj
+		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left,env)
+		left := e.Eval(node.Left,env)
 		if isError(left){
 			return left
 		}
-		index := Eval(node.Index,env)
+		index := e.Eval(node.Index,env)
 		if isError(index){
 			return index
 		}
 		return evalIndexExpression(left,index)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node,env)
+		return e.evalHashLiteral(node,env)
+	case *ast.AssignExpression:
+		return e.evalAssignExpression(node,env)
+	case *ast.UpdateExpression:
+		return e.evalUpdateExpression(node,env)
 
 	}
 	return nil
 }
 
-func evalHashLiteral(node *ast.HashLiteral,env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+// stack lists the running calls innermost first
+func (e *Evaluator) stack() []diagnostic.StackFrame {
+	if len(e.calls) == 0 {
+		return nil
+	}
+	stack := make([]diagnostic.StackFrame,len(e.calls))
+	for i,call := range e.calls {
+		stack[len(stack)-1-i] = call
+	}
+	return stack
+}
+
+// step counts a node against the budget and polls the context
+func (e *Evaluator) step() *object.Error {
+	if e.halt != nil {
+		return e.halt
+	}
+	e.steps++
+	if e.opts.MaxSteps > 0 && e.steps > e.opts.MaxSteps {
+		return e.stop(object.CodeStepLimit,"step limit of %d exceeded",e.opts.MaxSteps)
+	}
+	if e.opts.Context != nil && e.steps%contextCheckInterval == 0 {
+		if err := e.opts.Context.Err(); err != nil {
+			return e.stop(object.CodeCanceled,"evaluation canceled: %s",err)
+		}
+	}
+	return nil
+}
+
+// the approximate sizes in bytes charged for the values a script creates
+const (
+	valueSize = 16 // a string, array or hash header, or an array element
+	pairSize  = 64 // a hash entry with its key
+)
+
+func stringSize(n int) int64 {
+	return valueSize+int64(n)
+}
+
+func arraySize(n int) int64 {
+	return valueSize+int64(n)*valueSize
+}
+
+func hashSize(n int) int64 {
+	return valueSize+int64(n)*pairSize
+}
+
+// alloc charges size bytes against the memory limit, callers check it
+// before allocating so a huge value is refused rather than built
+func (e *Evaluator) alloc(size int64) *object.Error {
+	if e.halt != nil {
+		return e.halt
+	}
+	e.allocated += size
+	if e.opts.MaxMemory > 0 && (size > e.opts.MaxMemory || e.allocated > e.opts.MaxMemory) {
+		return e.stop(object.CodeMemoryLimit,"memory limit of %d bytes exceeded",e.opts.MaxMemory)
+	}
+	return nil
+}
+
+// Allocated returns the bytes charged so far
+func (e *Evaluator) Allocated() int64 {
+	return e.allocated
+}
+
+// stop records the error ending the evaluation
+func (e *Evaluator) stop(code string,format string,a ...any) *object.Error {
+	e.halt = newError(format,a...)
+	e.halt.Code = code
+	return e.halt
+}
+
+// loopControl inspects the result of a loop body, it reports whether the
+// loop must stop and the value the loop statement evaluates to
+func loopControl(result object.Object) (bool, object.Object) {
+	if result == nil {
+		return false,nil
+	}
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ,object.ERROR_OBJ:
+		return true,result
+	case object.BREAK_OBJ:
+		return true,nil
+	}
+	return false,nil
+}
+
+// evalTryStatement runs the catch block for an error of the body and
+// then the finally block, which overrides the result when it returns,
+// breaks or fails itself
+func (e *Evaluator) evalTryStatement(ts *ast.TryStatement,env *object.Environment) object.Object {
+	result := e.Eval(ts.Body,env)
+	if errObj,ok := result.(*object.Error); ok && ts.Catch != nil && errObj.Catchable() {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(ts.Param.Value,&object.Exception{Err: errObj})
+		result = e.Eval(ts.Catch,catchEnv)
+	}
+	if ts.Finally != nil {
+		if final := e.Eval(ts.Finally,env); isSignal(final) {
+			result = final
+		}
+	}
+	if isSignal(result) {
+		return result
+	}
+	return nil
+}
+
+// evalImportStatement loads a module in its own environment, the first
+// import of it evaluates it
+func (e *Evaluator) evalImportStatement(is *ast.ImportStatement,env *object.Environment) object.Object {
+	mod,errObj := e.opts.Modules.Load(is.Token.Pos.File,is.Path.Value,func(mod *object.Module,program *ast.Program) *object.Error {
+		e.calls = append(e.calls,module.Frame(mod,diagnostic.Span{Start: is.Pos(),End: is.End()}))
+		defer func() { e.calls = e.calls[:len(e.calls)-1] }()
+
+		moduleEnv := object.NewEnvironment()
+		if errObj,ok := e.Eval(program,moduleEnv).(*object.Error); ok {
+			return errObj
+		}
+		for _,name := range module.Exports(program) {
+			mod.Exports[name],_ = moduleEnv.Get(name)
+		}
+		return nil
+	})
+	if errObj != nil {
+		return errObj
+	}
+
+	if len(is.Names) == 0 {
+		env.Set(is.Name,mod)
+		return nil
+	}
+	for _,name := range is.Names {
+		val := evalModuleIndexExpression(mod,&object.String{Value: name.Value})
+		if isError(val){
+			return val
+		}
+		env.Set(name.Value,val)
+	}
+	return nil
+}
+
+// throw turns the value of a throw statement into the error it raises,
+// throwing a caught exception raises the original error again
+func throw(val object.Object) *object.Error {
+	if exception,ok := val.(*object.Exception); ok {
+		return exception.Err
+	}
+	return &object.Error{Message: val.Inspect(),Code: object.CodeThrown,Value: val}
+}
+
+// isSignal reports whether result stops the enclosing blocks
+func isSignal(result object.Object) bool {
+	if result == nil {
+		return false
+	}
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ,object.ERROR_OBJ,object.BREAK_OBJ,object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
+func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement,env *object.Environment) object.Object {
+	for {
+		condition := e.Eval(ws.Condition,env)
+		if isError(condition){
+			return condition
+		}
+		if !isTruthy(condition){
+			return nil
+		}
+		if stop,result := loopControl(e.Eval(ws.Body,env)); stop {
+			return result
+		}
+	}
+}
+
+func (e *Evaluator) evalForStatement(fs *ast.ForStatement,env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fs.Init != nil {
+		if init := e.Eval(fs.Init,loopEnv); isError(init){
+			return init
+		}
+	}
+	for {
+		if fs.Condition != nil {
+			condition := e.Eval(fs.Condition,loopEnv)
+			if isError(condition){
+				return condition
+			}
+			if !isTruthy(condition){
+				return nil
+			}
+		}
+		if stop,result := loopControl(e.Eval(fs.Body,loopEnv)); stop {
+			return result
+		}
+		if fs.Post != nil {
+			if post := e.Eval(fs.Post,loopEnv); isError(post){
+				return post
+			}
+		}
+	}
+}
+
+// evalForInStatement iterates over the elements of an array, the keys of
+// a hash or the characters of a string. With two variables the first one
+// gets the index, or the key of the hash.
+func (e *Evaluator) evalForInStatement(fs *ast.ForInStatement,env *object.Environment) object.Object {
+	iterable := e.Eval(fs.Iterable,env)
+	if isError(iterable){
+		return iterable
+	}
+	keys,values,errObj := e.forInValues(iterable,fs.Key != nil)
+	if errObj != nil {
+		return errObj
+	}
+
+	loopEnv := object.NewEnclosedEnvironment(env)
+	for i,value := range values {
+		if fs.Key != nil {
+			loopEnv.Set(fs.Key.Value,keys[i])
+		}
+		loopEnv.Set(fs.Value.Value,value)
+
+		if stop,result := loopControl(e.Eval(fs.Body,loopEnv)); stop {
+			return result
+		}
+	}
+	return nil
+}
+
+// forInValues lists what a for-in loop visits, keys holds the index or
+// the hash key of each value. A hash iterated with a single variable
+// gives its keys as the values.
+func (e *Evaluator) forInValues(iterable object.Object,withKey bool) ([]object.Object,[]object.Object,*object.Error) {
+	var keys,values []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		values = append(values,iterable.Elements...)
+		for i := range values {
+			keys = append(keys,&object.Integer{Value: int64(i)})
+		}
+	case *object.Hash:
+		for _,pair := range iterable.Ordered() {
+			keys = append(keys,pair.Key)
+			values = append(values,pair.Value)
+		}
+		if !withKey {
+			values = keys
+		}
+	case *object.String:
+		// by char, the keys are the indexes s[i] takes
+		chars := splitRunes(iterable.Value)
+		if errObj := e.alloc(int64(len(chars))*stringSize(1)); errObj != nil {
+			return nil,nil,errObj
+		}
+		for i,char := range chars {
+			keys = append(keys,&object.Integer{Value: int64(i)})
+			values = append(values,&object.String{Value: char})
+		}
+	default:
+		return nil,nil,newError("cannot iterate over %s",iterable.Type())
+	}
+	return keys,values,nil
+}
+
+// assignTarget resolves the place an assignment writes to, the operands
+// of an index target are evaluated only once
+type assignTarget struct {
+	name  string        // set for variables
+	left  object.Object // set for index targets
+	index object.Object
+}
+
+func (e *Evaluator) resolveAssignTarget(target ast.Expression,env *object.Environment) (*assignTarget,object.Object) {
+	switch target := target.(type) {
+	case *ast.Identifier:
+		return &assignTarget{name: target.Value},nil
+	case *ast.IndexExpression:
+		left := e.Eval(target.Left,env)
+		if isError(left){
+			return nil,left
+		}
+		index := e.Eval(target.Index,env)
+		if isError(index){
+			return nil,index
+		}
+		return &assignTarget{left: left,index: index},nil
+	default:
+		return nil,newError("cannot assign to %s",target.String())
+	}
+}
+
+func (at *assignTarget) get(env *object.Environment) object.Object {
+	if at.left == nil {
+		if val,ok := env.Get(at.name);ok {
+			return val
+		}
+		return newError("identifier not found: %s",at.name)
+	}
+	return evalIndexExpression(at.left,at.index)
+}
+
+func (at *assignTarget) set(e *Evaluator,env *object.Environment,val object.Object) object.Object {
+	if at.left == nil {
+		if _,ok := env.Assign(at.name,val);!ok {
+			return newError("identifier not found: %s",at.name)
+		}
+		return val
+	}
+	return e.setIndex(at.left,at.index,val)
+}
+
+func (e *Evaluator) setIndex(left,index,val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx,ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER. got=%s",index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d",idx.Value)
+		}
+		left.Elements[idx.Value] = val
+	case *object.Hash:
+		key,ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s",index.Type())
+		}
+		hashed := key.HashKey()
+		if _,ok := left.Pairs[hashed]; !ok {
+			if errObj := e.alloc(pairSize); errObj != nil {
+				return errObj
+			}
+		}
+		left.Set(hashed,object.HashPair{Key: index,Value: val})
+	default:
+		return newError("index assignment not supported: %s",left.Type())
+	}
+	return val
+}
+
+func (e *Evaluator) evalAssignExpression(node *ast.AssignExpression,env *object.Environment) object.Object {
+	target,errObj := e.resolveAssignTarget(node.Target,env)
+	if errObj != nil {
+		return errObj
+	}
+	val := e.Eval(node.Value,env)
+	if isError(val){
+		return val
+	}
+	if node.Operator != "=" {
+		current := target.get(env)
+		if isError(current){
+			return current
+		}
+		// x += y is x = x + y
+		val = e.evalInfixExpression(strings.TrimSuffix(node.Operator,"="),current,val)
+		if isError(val){
+			return val
+		}
+	}
+	return target.set(e,env,val)
+}
+
+// evalUpdateExpression evaluates ++ and --, the prefix form gives the new
+// value and the postfix form the old one
+func (e *Evaluator) evalUpdateExpression(node *ast.UpdateExpression,env *object.Environment) object.Object {
+	target,errObj := e.resolveAssignTarget(node.Target,env)
+	if errObj != nil {
+		return errObj
+	}
+	current := target.get(env)
+	if isError(current){
+		return current
+	}
+	updated := e.updateValue(node.Operator,current)
+	if isError(updated){
+		return updated
+	}
+	if result := target.set(e,env,updated); isError(result){
+		return result
+	}
+	if node.Prefix {
+		return updated
+	}
+	return current
+}
 
-	for keyNode,valueNode := range node.Pairs{
-		key := Eval(keyNode,env)
+// updateValue is the value ++ or -- gives for current
+func (e *Evaluator) updateValue(op string,current object.Object) object.Object {
+	if !isNumeric(current) {
+		return newError("unknown operator: %s%s",op,current.Type())
+	}
+	return e.evalInfixExpression(op[:1],current,&object.Integer{Value: 1})
+}
+
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral,env *object.Environment) object.Object {
+	if errObj := e.alloc(hashSize(len(node.Pairs))); errObj != nil {
+		return errObj
+	}
+	hash := object.NewHash(len(node.Keys))
+
+	for _,keyNode := range node.Keys {
+		valueNode := node.Pairs[keyNode]
+		key := e.Eval(keyNode,env)
 		if isError(key){
 			return key
 		}
@@ -115,22 +666,27 @@ func evalHashLiteral(node *ast.HashLiteral,env *object.Environment) object.Objec
 		if !ok {
 			return newError("unusable as hash key: %s",key.Type())
 		}
-		value := Eval(valueNode,env)
+		value := e.Eval(valueNode,env)
 		if isError(value){
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed]=object.HashPair{Key: key,Value:value}
+		hash.Set(hashKey.HashKey(),object.HashPair{Key: key,Value:value})
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 func evalIndexExpression(left ,index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type()==object.INTEGER_OBJ :
 		return evalArrayIndexExpression(left,index)
+	case left.Type() == object.STRING_OBJ && index.Type()==object.INTEGER_OBJ :
+		return evalStringIndexExpression(left,index)
 	case left.Type()==object.HASH_OBJ:
 		return evalHashIndexExpression(left,index)
+	case left.Type()==object.EXCEPTION_OBJ && index.Type()==object.STRING_OBJ:
+		return evalExceptionIndexExpression(left,index)
+	case left.Type()==object.MODULE_OBJ && index.Type()==object.STRING_OBJ:
+		return evalModuleIndexExpression(left,index)
 	default:
 		return newError("index operator not supported: %s",left.Type())
 	}
@@ -148,6 +704,39 @@ func evalHashIndexExpression(hash,index object.Object) object.Object {
 	}
 	return pair.Value
 }
+func evalModuleIndexExpression(mod,index object.Object) object.Object {
+	m := mod.(*object.Module)
+	name := index.(*object.String).Value
+	if val,ok := m.Exports[name]; ok {
+		return val
+	}
+	return newError("module %s does not export %s",m.Name,name)
+}
+
+// evalExceptionIndexExpression reads a field of a caught error
+func evalExceptionIndexExpression(exception,index object.Object) object.Object {
+	err := exception.(*object.Exception).Err
+	switch field := index.(*object.String).Value; field {
+	case "message":
+		return &object.String{Value: err.Message}
+	case "type":
+		return &object.String{Value: err.Kind()}
+	case "trace":
+		trace := err.Diagnostic().Trace()
+		elements := make([]object.Object,len(trace))
+		for i,line := range trace {
+			elements[i] = &object.String{Value: line}
+		}
+		return &object.Array{Elements: elements}
+	case "value":
+		if err.Value != nil {
+			return err.Value
+		}
+		return NULL
+	default:
+		return newError("unknown field of an exception: %s",field)
+	}
+}
 func evalArrayIndexExpression(array,index object.Object) object.Object {
 	arrayObj := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -159,20 +748,85 @@ func evalArrayIndexExpression(array,index object.Object) object.Object {
 	return arrayObj.Elements[idx]
 }
 
-func applyFunction(fn object.Object,args []object.Object) object.Object {
+// evalStringIndexExpression returns the char at index as a string, the
+// index counts chars like len does
+func evalStringIndexExpression(str,index object.Object) object.Object {
+	s := str.(*object.String).Value
+	idx := index.(*object.Integer).Value
+	if idx < 0 {
+		return NULL
+	}
+	for i := range s {
+		if idx == 0 {
+			_,size := utf8.DecodeRuneInString(s[i:])
+			return &object.String{Value: s[i:i+size]}
+		}
+		idx--
+	}
+	return NULL
+}
+
+// applyFunction calls fn, call is the call expression for the stack of
+// errors and may be nil
+func (e *Evaluator) applyFunction(fn object.Object,args []object.Object,call ast.Node) object.Object {
 	
 	switch fn:= fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments. got=%d, want=%d",len(args),len(fn.Parameters))
+		}
+		if len(e.calls) >= e.opts.MaxDepth {
+			return e.stop(object.CodeCallDepth,"maximum call depth of %d exceeded",e.opts.MaxDepth)
+		}
+		frame := diagnostic.StackFrame{Function: fn.Name}
+		if frame.Function == "" {
+			frame.Function = "<anonymous>"
+		}
+		if call != nil {
+			frame.Call = diagnostic.Span{Start: call.Pos(),End: call.End()}
+		}
 		extendedEnv := extendFunctionEnv(fn,args)
-		evaluated := Eval(fn.Body,extendedEnv)
+		e.calls = append(e.calls,frame)
+		evaluated := e.Eval(fn.Body,extendedEnv)
+		e.calls = e.calls[:len(e.calls)-1]
 		return unwrapReturnValue(evaluated)
+	case *Builtin:
+		saved := e.builtinCall
+		e.builtinCall = call
+		defer func() { e.builtinCall = saved }()
+		return fn.Fn(e,args...)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		return callHostBuiltin(fn,args)
 	default:
 		return newError("not a function: %s",fn.Type())
 	}
 }
 
+// callHostBuiltin calls a builtin registered by the program embedding the
+// interpreter. Its nil result is NULL and its panic a runtime error, so
+// a faulty builtin cannot take the host down.
+func callHostBuiltin(fn *object.Builtin,args []object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("builtin function panicked: %v",r)
+		}
+	}()
+	result = fn.Fn(args...)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// callFunction calls fn for the running builtin, a function of the vm
+// goes back to it
+func (e *Evaluator) callFunction(fn object.Object,args ...object.Object) object.Object {
+	if e.callback != nil {
+		return e.callback(fn,args)
+	}
+	return e.applyFunction(fn,args,e.builtinCall)
+}
+
 func extendFunctionEnv(fn *object.Function,args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -185,17 +839,21 @@ func extendFunctionEnv(fn *object.Function,args []object.Object) *object.Environ
 
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue,ok := obj.(*object.ReturnVALUE); ok {
-		return returnValue
+		return returnValue.Value
+	}
+	// a body ending with a statement has no value
+	if obj == nil {
+		return NULL
 	}
 	return obj
 }
 
-func evalExpressions(exps []ast.Expression,env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression,env *object.Environment) []object.Object {
 
 	var result []object.Object
 
-	for _,e := range exps {
-		evaluated := Eval(e,env)
+	for _,exp := range exps {
+		evaluated := e.Eval(exp,env)
 		if isError(evaluated){
 			return []object.Object{evaluated}
 		}
@@ -213,17 +871,17 @@ func evalIdentifier(node *ast.Identifier ,env *object.Environment) object.Object
 	}
 	return newError("identifier not found: %s", node.Value)
 }
-func evalIfExpression(ie *ast.IfExpression,env *object.Environment) object.Object{
-	condition := Eval(ie.Condition,env)
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression,env *object.Environment) object.Object{
+	condition := e.Eval(ie.Condition,env)
 
 	if isError(condition){
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence,env)
+		return e.Eval(ie.Consequence,env)
 	}else if ie.Alternative != nil {
-		return Eval(ie.Alternative,env)
+		return e.Eval(ie.Alternative,env)
 	}else {
 		return NULL
 	}
@@ -235,16 +893,16 @@ func isTruthy(obj object.Object) bool {
 	return true
 }
 
-func evalBlockStatement(stmts []ast.Statement,env *object.Environment) object.Object {
+func (e *Evaluator) evalBlockStatement(stmts []ast.Statement,env *object.Environment) object.Object {
 	var result object.Object
 
 	for _,statement := range stmts {
-		result = Eval(statement,env)
+		result = e.Eval(statement,env)
 
 		if result != nil{ 
 			rt := result.Type() 
 			
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ{
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ{
 				return result
 			}
 		}
@@ -252,11 +910,11 @@ func evalBlockStatement(stmts []ast.Statement,env *object.Environment) object.Ob
 	return result
 }
 
-func evalProgram(stmts []ast.Statement,env *object.Environment) object.Object {
+func (e *Evaluator) evalProgram(stmts []ast.Statement,env *object.Environment) object.Object {
 	var result object.Object
 
 	for _,statement := range stmts {
-		result = Eval(statement,env) 
+		result = e.Eval(statement,env) 
 
 		switch result := result.(type) {
 		case *object.ReturnVALUE :
@@ -269,19 +927,36 @@ func evalProgram(stmts []ast.Statement,env *object.Environment) object.Object {
 	return result
 }
 
-func evalInfixExpression(op string,left object.Object,right object.Object) object.Object {
+// evalLogicalExpression short-circuits && and ||, the result is the
+// operand that decided the outcome: 0 || "x" is "x", 0 && "x" is 0
+func (e *Evaluator) evalLogicalExpression(op string,left object.Object,right ast.Expression,env *object.Environment) object.Object {
+	if op == "&&" && !isTruthy(left) || op == "||" && isTruthy(left) {
+		return left
+	}
+	return e.Eval(right,env)
+}
+
+func (e *Evaluator) evalInfixExpression(op string,left object.Object,right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ :
 		return evalIntegerInfixExpression(op,left,right)
-	
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ || left.Type() == object.STRING_OBJ &&right.Type() == object.INTEGER_OBJ ||right.Type() == object.STRING_OBJ &&left.Type() == object.INTEGER_OBJ:
-		return evalStringInfixExpression(op,left,right)
 
+	case isNumeric(left) && isNumeric(right):
+		return evalFloatInfixExpression(op,left,right)
+
+	// any two values may be tested for equality, a value of another type
+	// is just not equal
 	case op == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left,right))
 
 	case op == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left,right))
+
+	case isComparison(op):
+		return evalComparison(op,left,right)
+	
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ || left.Type() == object.STRING_OBJ &&right.Type() == object.INTEGER_OBJ ||right.Type() == object.STRING_OBJ &&left.Type() == object.INTEGER_OBJ:
+		return e.evalStringInfixExpression(op,left,right)
 
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",left.Type(),op,right.Type())
@@ -289,9 +964,35 @@ func evalInfixExpression(op string,left object.Object,right object.Object) objec
 		return newError("unknown operator: %s %s %s",left.Type(),op,right.Type())
 	}
 }
-func evalStringInfixExpression(op string,left object.Object,right object.Object) object.Object {
+// interpolate joins the Inspect of the parts, strings come out without
+// their quotes
+func (e *Evaluator) interpolate(parts []object.Object) object.Object {
+	var out strings.Builder
+	for _,part := range parts {
+		out.WriteString(part.Inspect())
+	}
+	return e.newString(out.String())
+}
+
+func (e *Evaluator) evalStringInfixExpression(op string,left object.Object,right object.Object) object.Object {
 	switch op {
 	case "+":
+		// an integer takes at most 20 characters
+		size := 20
+		if str,ok := left.(*object.String); ok {
+			size += len(str.Value)
+		}
+		if str,ok := right.(*object.String); ok {
+			size += len(str.Value)
+		}
+		if errObj := e.alloc(stringSize(size)); errObj != nil {
+			return errObj
+		}
+		if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+			leftVal := left.(*object.String).Value
+			rightVal := right.(*object.String).Value
+			return &object.String{Value:leftVal+rightVal}
+		}
 		leftVal ,ok:= left.(*object.String)
 		if ok {
 			leftVal := leftVal.Value
@@ -303,17 +1004,25 @@ func evalStringInfixExpression(op string,left object.Object,right object.Object)
 				return &object.String{Value:fmt.Sprintf("%d%s",leftVal,rightVal)}
 			}
 	case "*":
-		leftVal ,ok:= left.(*object.String)
-		if ok {
-			leftVal := leftVal.Value
-			rightVal := right.(*object.Integer).Value
-			return &object.String{Value:strings.Repeat(leftVal,int(rightVal))}
-			}else {
-				leftVal := left.(*object.Integer).Value
-				rightVal := right.(*object.String).Value
-				return &object.String{Value:strings.Repeat(rightVal,int(leftVal))}
+		if left.Type() == right.Type() {
+			return newError("unknown operator: %s %s %s",left.Type(),op,right.Type())
 		}
-	
+		str,count := left,right
+		if left.Type() == object.INTEGER_OBJ {
+			str,count = right,left
+		}
+		n := count.(*object.Integer).Value
+		if n < 0 {
+			return newError("negative repeat count: %d",n)
+		}
+		value := str.(*object.String).Value
+		if len(value) > 0 && n > math.MaxInt/int64(len(value)) {
+			return newError("repeat count too large: %d",n)
+		}
+		if errObj := e.alloc(stringSize(len(value)*int(n))); errObj != nil {
+			return errObj
+		}
+		return &object.String{Value:strings.Repeat(value,int(n))}
 
 	default:
 		return newError("unknown operator: %s %s %s",left.Type(),op,right.Type())
@@ -324,26 +1033,220 @@ func evalIntegerInfixExpression(op string,left object.Object,right object.Object
 	leftVal   := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 	
+	switch op {
+	case "+","-","*","/":
+		return checkedArithmetic(op,leftVal,rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal>rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal<rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal>=rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal<=rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal==rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal!=rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",left.Type(),op,right.Type())
+		
+	}
+}
+
+// checkedArithmetic applies op to integers, a result that does not fit
+// in 64 bits is an error rather than wrapping around
+func checkedArithmetic(op string,a,b int64) object.Object {
+	var result int64
+	ok := true
+	switch op {
+	case "+":
+		result = a+b
+		ok = (result > a) == (b > 0)
+	case "-":
+		result = a-b
+		ok = (result < a) == (b > 0)
+	case "*":
+		result = a*b
+		ok = a == 0 || result/a == b && !(a == -1 && b == math.MinInt64)
+	case "/":
+		if b == 0 {
+			return newError("division by zero")
+		}
+		ok = !(a == math.MinInt64 && b == -1)
+		result = a/b
+	}
+	if !ok {
+		return newError("integer overflow: %d %s %d",a,op,b)
+	}
+	return &object.Integer{Value: result}
+}
+
+// evalFloatInfixExpression handles float operands, an integer on either
+// side is promoted to float
+func evalFloatInfixExpression(op string,left object.Object,right object.Object) object.Object {
+	leftVal   := toFloat(left)
+	rightVal := toFloat(right)
+
 	switch op {
 	case "+":
-		return &object.Integer{Value:leftVal+rightVal}
+		return &object.Float{Value:leftVal+rightVal}
 	case "-":
-		return &object.Integer{Value:leftVal-rightVal}
+		return &object.Float{Value:leftVal-rightVal}
 	case "*":
-		return &object.Integer{Value:leftVal*rightVal}
+		return &object.Float{Value:leftVal*rightVal}
 	case "/":
-		return &object.Integer{Value:leftVal/rightVal}
+		return &object.Float{Value:leftVal/rightVal}
 	case ">":
 		return nativeBoolToBooleanObject(leftVal>rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal<rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal>=rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal<=rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal==rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal!=rightVal)
 	default:
 		return newError("unknown operator: %s %s %s",left.Type(),op,right.Type())
-		
+	}
+}
+
+func isNumeric(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if i,ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==","!=","<",">","<=",">=":
+		return true
+	}
+	return false
+}
+
+// evalComparison orders strings and arrays. Strings are ordered byte by
+// byte, arrays element by element with the shorter prefix first, any
+// other value cannot be ordered.
+func evalComparison(op string,left object.Object,right object.Object) object.Object {
+	c,err := compareObjects(left,right)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "<":
+		return nativeBoolToBooleanObject(c < 0)
+	case ">":
+		return nativeBoolToBooleanObject(c > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(c <= 0)
+	default:
+		return nativeBoolToBooleanObject(c >= 0)
+	}
+}
+
+// compareObjects returns -1, 0 or 1 as left is less than, equal to or
+// greater than right
+func compareObjects(left,right object.Object) (int,*object.Error) {
+	return compareValues(left,right,map[[2]object.Object]bool{})
+}
+
+// compareValues compares left and right, comparing holds the pairs of
+// arrays being compared. Arrays may contain themselves, meeting a pair
+// again means nothing told them apart along the cycle.
+func compareValues(left,right object.Object,comparing map[[2]object.Object]bool) (int,*object.Error) {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return cmp.Compare(left.(*object.Integer).Value,right.(*object.Integer).Value),nil
+	case isNumeric(left) && isNumeric(right):
+		return cmp.Compare(toFloat(left),toFloat(right)),nil
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return strings.Compare(left.(*object.String).Value,right.(*object.String).Value),nil
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		pair := [2]object.Object{left,right}
+		if left == right || comparing[pair] {
+			return 0,nil
+		}
+		comparing[pair] = true
+		l,r := left.(*object.Array).Elements,right.(*object.Array).Elements
+		for i := 0; i < len(l) && i < len(r); i++ {
+			c,err := compareValues(l[i],r[i],comparing)
+			if err != nil || c != 0 {
+				return c,err
+			}
+		}
+		return cmp.Compare(len(l),len(r)),nil
+	default:
+		return 0,newError("cannot compare %s with %s",left.Type(),right.Type())
+	}
+}
+
+// objectsEqual compares values structurally, functions are only equal
+// to themselves
+func objectsEqual(left,right object.Object) bool {
+	return equal(left,right,map[[2]object.Object]bool{})
+}
+
+// equal compares left and right, comparing holds the pairs of arrays and
+// hashes being compared. Values may contain themselves, meeting a pair
+// again means nothing told them apart along the cycle.
+func equal(left,right object.Object,comparing map[[2]object.Object]bool) bool {
+	if isNumeric(left) && isNumeric(right) && left.Type() != right.Type() {
+		return toFloat(left) == toFloat(right)
+	}
+	if left.Type() != right.Type() {
+		return false
+	}
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.Float:
+		return left.Value == right.(*object.Float).Value
+	case *object.String:
+		return left.Value == right.(*object.String).Value
+	case *object.Array:
+		pair := [2]object.Object{left,right}
+		if left == right || comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		r := right.(*object.Array)
+		if len(left.Elements) != len(r.Elements) {
+			return false
+		}
+		for i := range left.Elements {
+			if !equal(left.Elements[i],r.Elements[i],comparing) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		pair := [2]object.Object{left,right}
+		if left == right || comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		r := right.(*object.Hash)
+		if len(left.Pairs) != len(r.Pairs) {
+			return false
+		}
+		for key,pair := range left.Pairs {
+			other,ok := r.Pairs[key]
+			if !ok || !equal(pair.Value,other.Value,comparing) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
 	}
 }
 
@@ -373,12 +1276,17 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return newError("integer overflow: -(%d)",right.Value)
+		}
+		return &object.Integer{Value:-right.Value}
+	case *object.Float:
+		return &object.Float{Value:-right.Value}
+	default:
 		return newError("unknown operator: -%s",right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value:-value}
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
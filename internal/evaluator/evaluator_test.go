@@ -1,6 +1,11 @@
 package evaluator
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/assimad8/go-interpreter/internal/lexer"
 	"github.com/assimad8/go-interpreter/internal/object"
 	"github.com/assimad8/go-interpreter/internal/parser"
@@ -29,6 +34,12 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0xff + 0o7 + 0b1", 263},
+		{"1_000 * 1_000", 1000000},
+		{"9223372036854775807 - 1 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"-4611686018427387904 * 2", -9223372036854775808},
+		{"-7 / 2", -3},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +48,35 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"1e2 - 1", 99},
+		{"let x = 1.5; x++; x", 2.5},
+		{"let x = 2; x *= 0.5; x", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v) for %q", evaluated, evaluated, tt.input)
+			continue
+		}
+		if result.Value != tt.expected {
+			t.Errorf("object has wrong value. got=%g, want=%g", result.Value, tt.expected)
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -61,6 +101,45 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 == 1.0", true},
+		{"0.5 < 1", true},
+		{"2.5 >= 2.5", true},
+		{"[1, 2.5] == [1.0, 2.5]", true},
+		{`"abc" == "abc"`, true},
+		{`"abc" != "abd"`, true},
+		{`"abc" < "abd"`, true},
+		{`"b" > "abc"`, true},
+		{`"ab" <= "ab"`, true},
+		{`"" >= "a"`, false},
+		{`1 == "1"`, false},
+		{`"1" != 1`, true},
+		{`"a" == true`, false},
+		{`[1] == ["a"]`, false},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2]] == [1, [3]]", false},
+		{"[1, 2] != [1]", true},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{`["b"] >= ["a", "z"]`, true},
+		{`{"a": [1]} == {"a": [1]}`, true},
+		// values that contain themselves
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", true},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a == b", false},
+		{"let a = [1, 2]; a[0] = a; let b = [1, 3]; b[0] = b; a < b", true},
+		{"let a = [1]; a[0] = a; a <= a", true},
+		{`let h = {}; h["h"] = h; let g = {}; g["h"] = g; h == g`, true},
+		{"1 == true", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false or false", false},
+		{"1 < 2 and 2 < 3", true},
+		{"!(1 > 2 || 2 > 3)", true},
 	}
 
 	for _, tt := range tests {
@@ -146,6 +225,16 @@ func TestErrorHandling(t *testing.T) {
 		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
 		{"foobar;", "identifier not found: foobar"},
 		{`{"name":"emad"}[fn(x){x}];`, "unusable as hash key: FUNCTION"},
+		{"7 / 0", "division by zero"},
+		{"let x = 0; 1 / x", "division by zero"},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"3037000500 * 3037000500", "integer overflow: 3037000500 * 3037000500"},
+		{"(-9223372036854775807 - 1) * -1", "integer overflow: -9223372036854775808 * -1"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)"},
+		{"let x = 9223372036854775807; x++", "integer overflow: 9223372036854775807 + 1"},
+		{"let x = 9223372036854775807; x *= 2", "integer overflow: 9223372036854775807 * 2"},
 	}
 
 	for _, tt := range tests {
@@ -218,6 +307,255 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+		let newAdder = fn(x) { fn(y) { x + y } };
+		let addTwo = newAdder(2);
+		addTwo(3);`, 5},
+		{`
+		let base = 10;
+		let addBase = fn(x) { x + base };
+		addBase(5);`, 15},
+		{`
+		let curry = fn(a) { fn(b) { fn(c) { a * 100 + b * 10 + c } } };
+		curry(1)(2)(3);`, 123},
+		{`
+		let x = 1;
+		let shadow = fn(x) { let inner = fn() { x }; inner() };
+		shadow(2) * 10 + x;`, 21},
+		{`
+		let x = 1;
+		let f = fn() { let x = 5; x };
+		f() + x;`, 6},
+		{`
+		let makeCounter = fn(start) { fn(step) { start + step } };
+		let a = makeCounter(10);
+		let b = makeCounter(20);
+		a(1) + b(2);`, 33},
+		{`
+		let apply = fn(f, x) { f(x) };
+		let twice = fn(f) { fn(x) { f(f(x)) } };
+		apply(twice(fn(x) { x * 3 }), 2);`, 18},
+		{`
+		let fact = fn(n) { if (n < 2) { return 1; } n * fact(n - 1) };
+		fact(5);`, 120},
+		{`
+		let outer = fn() {
+			let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+			fib(10)
+		};
+		outer();`, 55},
+		{`
+		let early = fn(x) { if (x > 0) { return x * 2; } return 0; };
+		early(3) + early(-1);`, 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestWrongNumberOfArguments(t *testing.T) {
+	evaluated := testEval("let add = fn(a, b) { a + b }; add(1);")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := "wrong number of arguments. got=1, want=2"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (i < 100000) { let i = i + 1; }; i", 100000},
+		{"let i = 0; while (i < 10) { let i = i + 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + 1; }; n", 3},
+		{"while (false) { 1 }", nil},
+		{"let find = fn(arr) { for (x in arr) { if (x > 2) { return x; } } }; find([1, 2, 3, 4])", 3},
+		{"let find = fn(arr) { for (x in arr) { if (x > 9) { return x; } } }; find([1, 2])", nil},
+		{"let at = fn(arr) { for (i, x in arr) { if (x == 30) { return i; } } }; at([10, 20, 30])", 2},
+		{`let get = fn(h) { for (k, v in h) { if (k == 2) { return v; } } }; get({1: "a", 2: 20})`, 20},
+		{`let key = fn(h) { for (k in h) { return k; } }; key({7: "x"})`, 7},
+		{`let third = fn(s) { for (i, c in s) { if (i == 2) { return c; } } }; third("hello")`, "l"},
+		{"let f = fn() { for (let i = 0; i < 10; let i = i + 1) { if (i == 4) { return i * 10; } } }; f()", 40},
+		{"let f = fn() { for (let i = 0; ; let i = i + 1) { if (i < 3) { continue; } return i; } }; f()", 3},
+		{"let f = fn() { for (x in [1, 2]) { for (y in [3, 4]) { if (y == 3) { continue; } return x * y; } } }; f()", 4},
+		{"let f = fn() { for (x in [5, 6]) { for (y in [3, 4]) { break; } return x; } }; f()", 5},
+		{"let i = 100; for (i in [1, 2]) { }; i", 100},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		default:
+			if evaluated == nil {
+				continue
+			}
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (x in 5) { }", "cannot iterate over INTEGER"},
+		{"while (1 + true) { }", "type mismatch: INTEGER + BOOLEAN"},
+		{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 2; x = y = 7; x + y", 14},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let x = 1; let f = fn() { x = 2 }; f(); x", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() * 10 + x", 61},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x; }; sum", 6},
+		{"let n = 0; for (let i = 0; i < 10; i++) { n += i; }; n", 45},
+		{"let i = 0; while (i < 5) { i++; }; i", 5},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr[1] + arr[2]", 23},
+		{"let arr = [1, 2, 3]; arr[0] += 9; arr[0]", 10},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"a": 1}; h["a"] *= 5; h["a"]`, 5},
+		{"let x = 5; x++", 5},
+		{"let x = 5; x++; x", 6},
+		{"let x = 5; ++x", 6},
+		{"let x = 5; x--; --x", 3},
+		{"let arr = [1]; arr[0]++; arr[0]", 2},
+		{"let arr = [1, 2]; let i = 0; arr[i++] = 9; arr[0] * 10 + i", 91},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"y = 1", "identifier not found: y"},
+		{"y += 1", "identifier not found: y"},
+		{"let f = fn() { let z = 1; }; f(); z = 2", "identifier not found: z"},
+		{"let arr = [1]; arr[3] = 1", "index out of range: 3"},
+		{`let arr = [1]; arr["a"] = 1`, "array index must be INTEGER. got=STRING"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let h = {}; h[fn(){}] = 1`, "unusable as hash key: FUNCTION"},
+		{"let x = true; x += 1", "type mismatch: BOOLEAN + INTEGER"},
+		{`let s = "a"; s++`, "unknown operator: ++STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`0 || "x"`, 0},
+		{`false || "x"`, "x"},
+		{`1 && "x"`, "x"},
+		{`false && "x"`, false},
+		{`let name = if (false) { "n" }; name || "anonymous"`, "anonymous"},
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); n", 0},
+		{"let n = 0; let f = fn() { n += 1; true }; true || f(); n", 0},
+		{"let n = 0; let f = fn() { n += 1; true }; true and f() and f(); n", 2},
+		{"false && undefined", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestComparisonErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"[1] < [true]", "cannot compare INTEGER with BOOLEAN"},
+		{`[1] < ["a"]`, "cannot compare INTEGER with STRING"},
+		{`1 < "a"`, "cannot compare INTEGER with STRING"},
+		{`"a" < 1`, "cannot compare STRING with INTEGER"},
+		{"true >= false", "cannot compare BOOLEAN with BOOLEAN"},
+		{"1 <= true", "cannot compare INTEGER with BOOLEAN"},
+		{`"a" * -1`, "negative repeat count: -1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 
@@ -244,6 +582,41 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let user = {"name": "Ada"}; let items = [1, 2]; "Hello ${user["name"]}, you have ${len(items)} items"`, "Hello Ada, you have 2 items"},
+		{`let x = 1.5; "${x * 2}|${true}|${[1, "a"]}|${{"k": "v"}}"`, "3.0|true|[1, a]|{k: v}"},
+		{`let f = fn(n) { "n=${n}" }; f(f(1))`, "n=n=1"},
+		{`"${"in ${1 + 1}"}!"`, "in 2!"},
+		{`'single ${1}' + ` + "`raw ${1}`", "single 1raw ${1}"},
+		{`"\${1}"`, "${1}"},
+		{`let x = 0; "${x = 5}"; x`, 5},
+		{`"a ${1 + true} b"`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`"a ${missing}"`, errorMessage("identifier not found: missing")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: wrong value. expected=%q, got=%s", tt.input, expected, inspectOrNil(evaluated))
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q. got=%s", tt.input, expected, inspectOrNil(evaluated))
+			}
+		}
+	}
+}
+
 func TestBuiltinFunction(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -251,8 +624,14 @@ func TestBuiltinFunction(t *testing.T) {
 	}{
 		{`len("")`, 0},
 		{`len("four")`, 4},
+		{`len("héllo wörld")`, 11},
+		{`len("😀")`, 1},
 		{`len(1)`, "argument to 'len' not supported. got INTEGER"},
 		{`len("one","two")`,"wrong number of arguments. got=2, want=1"},
+		{`rest([1, 2, 3])[0]`, 2},
+		{`rest([1, 2, 3])[1]`, 3},
+		{`len(rest([1]))`, 0},
+		{`rest(1)`, "argument to 'rest' must be ARRAY. got=INTEGER"},
 	}
 
 	for _,tt := range tests {
@@ -274,6 +653,218 @@ func TestBuiltinFunction(t *testing.T) {
 	}
 }
 
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`split("a,b,,c", ",")`, []string{"a","b","","c"}},
+		{`split("héllo", "")`, []string{"h","é","l","l","o"}},
+		{`join(["a","b","c"], "-")`, "a-b-c"},
+		{`join([], "-")`, ""},
+		{`trim("  hi there  ")`, "hi there"},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`upper("grün")`, "GRÜN"},
+		{`lower("ÉTÉ")`, "été"},
+		{`contains("seafood", "foo")`, true},
+		{`contains("seafood", "bar")`, false},
+		{`index_of("héllo", "l")`, 2},
+		{`index_of("héllo", "z")`, -1},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("a-b-c", "-", "+", 1)`, "a+b-c"},
+		{`starts_with("prefix", "pre")`, true},
+		{`ends_with("prefix", "pre")`, false},
+		{`substr("héllo", 1)`, "éllo"},
+		{`substr("héllo", 1, 3)`, "éll"},
+		{`substr("héllo", 4, 10)`, "o"},
+		{`substr("abc", 1, 9223372036854775807)`, "bc"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`format("%s has %d items", "cart", 3)`, "cart has 3 items"},
+		{`format("%5.2f|%-4s|%x|%t|%q|%%", 3.14159, "ab", 255, true, "hi")`, ` 3.14|ab  |ff|true|"hi"|%`},
+		{`format("%v and %s", [1, 2], 1.5)`, "[1, 2] and 1.5"},
+		{`format("%c", 233)`, "é"},
+		{`join(map(bytes("é!"), fn(b) { format("%x", b) }), " ")`, "c3 a9 21"},
+		{`len(bytes("héllo"))`, 6},
+
+		{`bytes(1)`, errorMessage("argument to 'bytes' must be STRING. got=INTEGER")},
+		{`upper(1)`, errorMessage("argument to 'upper' must be STRING. got=INTEGER")},
+		{`split("a")`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`split("a", 1)`, errorMessage("argument 2 to 'split' must be STRING. got=INTEGER")},
+		{`trim("a", "b", "c")`, errorMessage("wrong number of arguments. got=3, want=1..2")},
+		{`join(["a", 1], "")`, errorMessage("element 1 of the array passed to 'join' must be STRING. got=INTEGER")},
+		{`substr("abc", 4)`, errorMessage("start of 'substr' out of range. got=4, length=3")},
+		{`substr("abc", 0, -1)`, errorMessage("length of 'substr' must not be negative. got=-1")},
+		{`repeat("ab", -1)`, errorMessage("negative repeat count: -1")},
+		{`format()`, errorMessage("wrong number of arguments. got=0, want>=1")},
+		{`format("%d", "x")`, errorMessage("format: %d does not take STRING")},
+		{`format("%d %d", 1)`, errorMessage("format: missing argument for %d")},
+		{`format("%d", 1, 2)`, errorMessage("format: 2 arguments given, the layout uses 1")},
+		{`format("%y", 1)`, errorMessage("format: unknown verb %y")},
+		{`format("100%")`, errorMessage("format: missing verb at the end of \"100%\"")},
+	}
+
+	for _,tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t,evaluated,int64(expected))
+		case bool:
+			testBooleanObject(t,evaluated,expected)
+		case string:
+			str,ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("%s: object is not String. got=%T (%+v)",tt.input,evaluated,evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("%s: wrong value. expected=%q, got=%q",tt.input,expected,str.Value)
+			}
+		case []string:
+			arr,ok := evaluated.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("%s: wrong array. got=%s",tt.input,inspectOrNil(evaluated))
+				continue
+			}
+			for i,el := range arr.Elements {
+				if str,ok := el.(*object.String); !ok || str.Value != expected[i] {
+					t.Errorf("%s: wrong element %d. expected=%q, got=%s",tt.input,i,expected[i],el.Inspect())
+				}
+			}
+		case errorMessage:
+			errObj,ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)",tt.input,evaluated,evaluated)
+				continue
+			}
+			if errObj.Message != string(expected) {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q",tt.input,expected,errObj.Message)
+			}
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map(["a", "b"], upper)`, `[A, B]`},
+		{`filter(range(10), fn(x) { x / 3 * 3 == x })`, "[0, 3, 6, 9]"},
+		{`filter([1, 2], fn(x) { false })`, "[]"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], fn(acc, x) { acc + x }, 5)`, "5"},
+		{`let n = 0; each([1, 2, 3], fn(x) { n = n + x }); n`, "6"},
+		{`find([1, 5, 10], fn(x) { x > 3 })`, "5"},
+		{`find([1, 5, 10], fn(x) { x > 30 })`, "null"},
+		{`[any([1, 2], fn(x) { x > 1 }), any([], fn(x) { true })]`, "[true, false]"},
+		{`[all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`, "[false, true]"},
+		{`sort([3, 1.5, 2])`, "[1.5, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { b - a })`, "[3, 2, 1]"},
+		{`sort([[2, "x"], [1, "y"], [2, "z"]], fn(a, b) { a[0] - b[0] })`, "[[1, y], [2, x], [2, z]]"},
+		{`let a = [1, 2]; reverse(a); a`, "[1, 2]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`range(3)`, "[0, 1, 2]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]"},
+		{`range(5, 2)`, "[]"},
+		{`flatten([1, [2, [3]], []])`, "[1, 2, [3]]"},
+		{`flatten([1, [2, [3, [4]]]], 10)`, "[1, 2, 3, 4]"},
+		{`let b = [1]; flatten([b, [b], b], 5)`, "[1, 1, 1]"},
+		{`unique([1, "a", 1, [1], "a", [1], true])`, "[1, a, [1], true]"},
+		{`unique([1, 1.0, 2.5, 2.5, 0, -0.0, 3.0])`, "[1, 2.5, 0, 3.0]"},
+
+		{`map([1], 1)`, errorMessage("argument 2 to 'map' must be FUNCTION. got=INTEGER")},
+		{`map([1], fn(a, b) { a })`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`map([1, 2], fn(x) { x + true })`, errorMessage("type mismatch: INTEGER + BOOLEAN")},
+		{`reduce([], fn(acc, x) { x })`, errorMessage("reduce of an empty array with no initial value")},
+		{`sort([1, "a"])`, errorMessage("cannot compare INTEGER with STRING")},
+		{`sort([3, 2, "a", 1])`, errorMessage("cannot compare INTEGER with STRING")},
+		{`sort(["a", 1])`, errorMessage("cannot compare STRING with INTEGER")},
+		{`sort([1, 2], fn(a, b) { true })`, errorMessage("comparator of 'sort' must return INTEGER. got=BOOLEAN")},
+		{`range(1, 2, 0)`, errorMessage("step of 'range' must not be 0")},
+		{`zip([1])`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`let a = [1]; a[0] = a; flatten(a, 100000000)`, errorMessage("cannot flatten an array that contains itself")},
+		{`let a = [1]; let b = [a]; a[0] = b; flatten([b], 100000000)`, errorMessage("cannot flatten an array that contains itself")},
+		{`let r = ""; try { each([1], fn(x) { throw "stop"; }) } catch (e) { r = e["message"]; }; r`, "stop"},
+	}
+
+	for _,tt := range tests {
+		testResult(t,tt.input,testEval(tt.input),tt.expected)
+	}
+}
+
+// a callback runs as a call of the builtin's call expression
+func TestCallbackStack(t *testing.T) {
+	input := "let f = fn(x) { x + true };\nmap([1], f)"
+	errObj,ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error")
+	}
+	if len(errObj.Stack) != 1 || errObj.Stack[0].Function != "f" || errObj.Stack[0].Call.Start.Line != 2 || errObj.Stack[0].Call.Start.Column != 1 {
+		t.Errorf("wrong stack. got=%+v",errObj.Stack)
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, "{b: 1, a: 2, 3: 3, true: 4}"},
+		{`let h = {"b": 1}; h["a"] = 2; h["b"] = 3; h`, "{b: 3, a: 2}"},
+		{`let ks = []; for (k in {"z": 1, "y": 2, "x": 3}) { ks = push(ks, k) }; ks`, "[z, y, x]"},
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`items({"b": 1, "a": 2})`, "[[b, 1], [a, 2]]"},
+		{`keys({})`, "[]"},
+		{`[has({"a": 1}, "a"), has({"a": 1}, "b")]`, "[true, false]"},
+		{`[{1: "a"}[1.0], {0.0: "b"}[-0], has({2.5: 1}, 2.5), has({1: 1}, 1.5)]`, "[a, b, true, false]"},
+		{`let h = {1: "a"}; h[1.0] = "b"; [len(keys(h)), h[1]]`, "[1, b]"},
+		{`let h = {"a": 1, "b": 2, "c": 3}; let v = delete(h, "b"); [v, h]`, "[2, {a: 1, c: 3}]"},
+		{`let h = {"a": 1}; delete(h, "a"); h["a"] = 2; h["b"] = 3; delete(h, "x"); h`, "{a: 2, b: 3}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4}, {"d": 5})`, "{a: 1, b: 3, c: 4, d: 5}"},
+		{`let h = {"a": 1}; merge(h, {"a": 2}); h`, "{a: 1}"},
+
+		{`keys([1])`, errorMessage("argument to 'keys' must be HASH. got=ARRAY")},
+		{`has({}, [1])`, errorMessage("unusable as hash key: ARRAY")},
+		{`delete({})`, errorMessage("wrong number of arguments. got=1, want=2")},
+		{`merge({}, 1)`, errorMessage("argument 2 to 'merge' must be HASH. got=INTEGER")},
+		{`merge()`, errorMessage("wrong number of arguments. got=0, want>=1")},
+	}
+
+	for _,tt := range tests {
+		testResult(t,tt.input,testEval(tt.input),tt.expected)
+	}
+}
+
+// errorMessage marks the expected results that are errors
+type errorMessage string
+
+// testResult checks the printed value of evaluated, or its message when
+// expected is an errorMessage
+func testResult(t *testing.T,input string,evaluated object.Object,expected any) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case string:
+		if isError(evaluated) || inspectOrNil(evaluated) != expected {
+			t.Errorf("%s: wrong result. expected=%s, got=%s",input,expected,inspectOrNil(evaluated))
+		}
+	case errorMessage:
+		errObj,ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: object is not Error. got=%T (%+v)",input,evaluated,evaluated)
+			return
+		}
+		if errObj.Message != string(expected) {
+			t.Errorf("%s: wrong error message. expected=%q, got=%q",input,expected,errObj.Message)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1,1*1,2+2]"
 
@@ -306,6 +897,7 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{"[1,2,3][1+1]",3},
 		{"let myArray = [1,2,3];myArray[0]",1},
 		{"let myArray = [1,2,3];myArray[0]+myArray[1]",3},
+		{"let a = [1]; a[0] = a; len(format(\"%v\", a))",7},
 		{"[1,2,3][3]",nil},
 		{"[1,2,3][-1]",nil},
 	}
@@ -322,6 +914,41 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"abc"[0]`, "a"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`let s = "東京😀"; s[len(s) - 1]`, "😀"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+		{`let out = ""; for (i, c in "aé😀") { out += format("%d:%s ", i, c) }; out`, "0:a 1:é 2:😀 "},
+		{`let größe = "ü"; größe[0]`, "ü"},
+		{`"abc"["a"]`, errorMessage("index operator not supported: STRING")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: wrong value. expected=%q, got=%s", tt.input, expected, inspectOrNil(evaluated))
+			}
+		case errorMessage:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != string(expected) {
+				t.Errorf("%s: expected error %q. got=%s", tt.input, expected, inspectOrNil(evaluated))
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
 	{
@@ -385,6 +1012,284 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	} 
 }
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet y = x + z;", "ERROR: 2:13: identifier not found: z"},
+		{"if (true) {\n  5 + true;\n}", "ERROR: 2:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(x) { len(x) };\nf(1)", "ERROR: 1:17: argument to 'len' not supported. got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+		}
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Inspect())
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let check = fn(x) {
+  if (x > 2) { x + true } else { 0 }
+};
+let apply = fn(f, xs) {
+  for (x in xs) { f(x); }
+};
+let run = fn() { apply(check, [1, 2, 3]) };
+run();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		function string
+		call     string
+	}{
+		{"check", "5:19"},
+		{"apply", "7:18"},
+		{"run", "8:1"},
+	}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack length. expected=%d, got=%d (%+v)", len(expected), len(errObj.Stack), errObj.Stack)
+	}
+	for i, frame := range expected {
+		got := errObj.Stack[i]
+		if got.Function != frame.function || got.Call.Start.String() != frame.call {
+			t.Errorf("wrong frame %d. expected=%s at %s, got=%s at %s", i, frame.function, frame.call, got.Function, got.Call.Start)
+		}
+	}
+
+	evaluated = testEval("fn() { 1 + true }()")
+	if errObj, ok := evaluated.(*object.Error); !ok || len(errObj.Stack) != 1 || errObj.Stack[0].Function != "<anonymous>" {
+		t.Errorf("expected an anonymous frame. got=%T (%+v)", evaluated, evaluated)
+	}
+	evaluated = testEval("1 + true")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Stack != nil {
+		t.Errorf("expected an error without stack. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let r = 0; try { let r = 1; } catch (e) { let r = 2; }; r`, 1},
+		{`let m = ""; try { 1 + true } catch (e) { m = e["message"]; }; m`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let m = ""; try { len(1) } catch (e) { m = e["type"] + ": " + e["message"]; }; m`, "RuntimeError: argument to 'len' not supported. got INTEGER"},
+		{`let v = 0; try { throw 42; } catch (e) { v = e["value"]; }; v`, 42},
+		{`let m = ""; try { throw "boom"; } catch (e) { m = e["type"] + ": " + e["message"]; }; m`, "Error: boom"},
+		{`let f = fn() { throw "deep"; }; let m = ""; try { f() } catch (e) { m = e["trace"][0]; }; m`, "f (1:16)"},
+		{`let m = ""; try { try { throw 1; } catch (e) { e["stak"]; } } catch (e) { m = e["message"]; }; m`, "unknown field of an exception: stak"},
+		{`let log = []; try { log = push(log, 1); } finally { log = push(log, 2); }; log`, "[1, 2]"},
+		{`let log = []; try { throw 1; } catch (e) { log = push(log, e["value"]); } finally { log = push(log, 2); }; log`, "[1, 2]"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw 1; } finally { return 3; } }; f()`, 3},
+		{`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n += x; } }; n`, 3},
+		{`let inner = ""; try { try { throw "a"; } catch (e) { throw e; } } catch (e) { inner = e["message"]; }; inner`, "a"},
+		{`let t = ""; try { throw {"code": 7}; } catch (e) { t = e["value"]["code"]; }; t`, 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. expected=%q, got=%T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestThrowErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+		expected     string
+	}{
+		{`throw "boom";`, object.CodeThrown, "ERROR: 1:1: boom"},
+		{`try { throw 1; } finally { 2 }`, object.CodeThrown, "ERROR: 1:7: 1"},
+		{`try { 1 } catch (e) { 2 } finally { throw "late"; }`, object.CodeThrown, "ERROR: 1:37: late"},
+		// rethrowing keeps where the error was first raised
+		{"let f = fn() { 1 + true };\ntry { f() } catch (e) { throw e; }", object.CodeRuntimeError, "ERROR: 1:16: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Diagnostic().Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%q, got=%q", tt.input, tt.expectedCode, errObj.Diagnostic().Code)
+		}
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Inspect())
+		}
+	}
+
+	// the limits stop the evaluation, a try cannot catch them
+	program := parser.New(lexer.New("let f = fn() { f() }; try { f() } catch (e) { 1 }")).ParseProgram()
+	evaluated := New(Options{MaxDepth: 10}).Eval(program, object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Code != object.CodeCallDepth {
+		t.Errorf("expected a call depth error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.mk":    "let hidden = fn(x) { x * 2 };\nexport let double = fn(x) { hidden(x) };\nexport let name = \"lib\";",
+		"shared.mk": `export let state = {"n": 0};`,
+		"a.mk":      `import "b";`,
+		"b.mk":      `import "a";`,
+		"bad.mk":    "export let broken = fn() { 1 + true };",
+		"fails.mk":  "1 + true;",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`import "lib"; lib["double"](21)`, 42},
+		{`import { double, name } from "./lib"; name + double(1)`, "lib2"},
+		// the second import gets the cached module
+		{`import { state } from "shared"; state["n"] += 1; import "shared"; shared["state"]["n"]`, 1},
+		{`import "lib"; lib["hidden"]`, "ERROR: " + main + ":1:15: module lib does not export hidden"},
+		{`import { x } from "lib";`, "ERROR: " + main + ":1:1: module lib does not export x"},
+		{`import "missing";`, "ERROR: " + main + ":1:1: cannot find module \"missing\", looked for " + filepath.Join(dir, "missing.mk")},
+		{`import "a";`, "ERROR: " + filepath.Join(dir, "b.mk") + ":1:1: import cycle: " + filepath.Join(dir, "a.mk") + " -> " + filepath.Join(dir, "b.mk") + " -> " + filepath.Join(dir, "a.mk")},
+		{`import { broken } from "bad"; broken()`, "ERROR: " + filepath.Join(dir, "bad.mk") + ":1:28: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.NewFile(main, tt.input)).ParseProgram()
+		evaluated := Eval(program, object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q.\nexpected=%q\ngot=%q", tt.input, expected, inspectOrNil(evaluated))
+			}
+		}
+	}
+
+	// an error raised while a module runs has the import in its stack
+	program := parser.New(lexer.NewFile(main, `import "fails";`)).ParseProgram()
+	errObj, ok := Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok || len(errObj.Stack) != 1 || errObj.Stack[0].Function != "<module fails>" || errObj.Stack[0].Call.Start.String() != main+":1:1" {
+		t.Errorf("expected a module frame. got=%+v", errObj)
+	}
+}
+
+func inspectOrNil(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+func TestExecutionLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		input        string
+		opts         Options
+		expectedCode string
+		expected     string
+	}{
+		{"let f = fn() { f() }; f()", Options{}, object.CodeCallDepth, "ERROR: 1:16: maximum call depth of 10000 exceeded"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } else { n } }; f(50)", Options{MaxDepth: 10}, object.CodeCallDepth, "ERROR: 1:30: maximum call depth of 10 exceeded"},
+		{"while (true) { }", Options{MaxSteps: 1000}, object.CodeStepLimit, "ERROR: 1:8: step limit of 1000 exceeded"},
+		// within the call depth but too deep counting the nodes of each call
+		{"let f = fn(n) { if (n > 0) { " + strings.Repeat("- ", 40) + "f(n - 1) } else { n } }; f(9000)", Options{}, object.CodeNesting, "maximum nesting depth of 200000 exceeded"},
+		{"let i = 0; while (true) { i++ }", Options{Context: canceled}, object.CodeCanceled, "evaluation canceled: context canceled"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(tt.opts).Eval(program, object.NewEnvironment())
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Code != tt.expectedCode {
+			t.Errorf("wrong code for %q. expected=%q, got=%q", tt.input, tt.expectedCode, errObj.Code)
+		}
+		if !strings.HasSuffix(errObj.Inspect(), tt.expected) {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Inspect())
+		}
+	}
+
+	// limits that are not reached leave the result alone
+	program := parser.New(lexer.New("let f = fn(n) { if (n > 0) { f(n - 1) } else { n } }; f(5)")).ParseProgram()
+	evaluated := New(Options{Context: context.Background(), MaxDepth: 6, MaxSteps: 1000}).Eval(program, object.NewEnvironment())
+	testIntegerObject(t, evaluated, 0)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a" * 1000000000`, "ERROR: 1:1: memory limit of 10000 bytes exceeded"},
+		{`let s = "ab"; while (true) { s = s + s; }`, "memory limit of 10000 bytes exceeded"},
+		{`let a = []; while (true) { a = push(a, 1); }`, "ERROR: 1:32: memory limit of 10000 bytes exceeded"},
+		{`let h = {}; let i = 0; while (true) { h[i] = i; i++; }`, "memory limit of 10000 bytes exceeded"},
+		{`for (c in "x" * 5000) { }`, "ERROR: 1:1: memory limit of 10000 bytes exceeded"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := New(Options{MaxMemory: 10000}).Eval(program, object.NewEnvironment())
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+		if errObj.Code != object.CodeMemoryLimit || !strings.HasSuffix(errObj.Inspect(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%s %q", tt.input, tt.expected, errObj.Code, errObj.Inspect())
+		}
+	}
+
+	ev := New(Options{MaxMemory: 10000})
+	evaluated := ev.Eval(parser.New(lexer.New(`let a = push([1, 2], 3); "ab" + "cd"`)).ParseProgram(), object.NewEnvironment())
+	if str, ok := evaluated.(*object.String); !ok || str.Value != "abcd" {
+		t.Errorf("wrong result. got=%T (%+v)", evaluated, evaluated)
+	}
+	if ev.Allocated() <= 0 || ev.Allocated() > 10000 {
+		t.Errorf("wrong allocated bytes. got=%d", ev.Allocated())
+	}
+
+	// without a limit the repeat count is still checked before the
+	// allocation
+	evaluated = testEval(`"ab" * 9223372036854775807`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "repeat count too large: 9223372036854775807" {
+		t.Errorf("expected a repeat count error. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
 // helper functions
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
@@ -0,0 +1,114 @@
+package evaluator
+
+import "github.com/assimad8/go-interpreter/internal/object"
+
+// hashBuiltins list pairs in insertion order, like Inspect and for-in
+var hashBuiltins = map[string]*Builtin{
+	"keys": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("keys", args, 1, object.HASH_OBJ); errObj != nil {
+				return errObj
+			}
+			pairs := args[0].(*object.Hash).Ordered()
+			keys := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				keys[i] = pair.Key
+			}
+			return e.newArray(keys)
+		},
+	},
+	"values": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("values", args, 1, object.HASH_OBJ); errObj != nil {
+				return errObj
+			}
+			pairs := args[0].(*object.Hash).Ordered()
+			values := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				values[i] = pair.Value
+			}
+			return e.newArray(values)
+		},
+	},
+	"items": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("items", args, 1, object.HASH_OBJ); errObj != nil {
+				return errObj
+			}
+			pairs := args[0].(*object.Hash).Ordered()
+			if errObj := e.alloc(arraySize(len(pairs)) + int64(len(pairs))*arraySize(2)); errObj != nil {
+				return errObj
+			}
+			items := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				items[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+			}
+			return &object.Array{Elements: items}
+		},
+	},
+	"has": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("has", args, 2, object.HASH_OBJ, ""); errObj != nil {
+				return errObj
+			}
+			key, errObj := hashKey(args[1])
+			if errObj != nil {
+				return errObj
+			}
+			_, ok := args[0].(*object.Hash).Pairs[key]
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+	"delete": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("delete", args, 2, object.HASH_OBJ, ""); errObj != nil {
+				return errObj
+			}
+			key, errObj := hashKey(args[1])
+			if errObj != nil {
+				return errObj
+			}
+			hash := args[0].(*object.Hash)
+			pair, ok := hash.Pairs[key]
+			if !ok {
+				return NULL
+			}
+			hash.Delete(key)
+			return pair.Value
+		},
+	},
+	"merge": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want>=1", len(args))
+			}
+			size := 0
+			for i, arg := range args {
+				hash, ok := arg.(*object.Hash)
+				if !ok {
+					return newError("argument %d to 'merge' must be HASH. got=%s", i+1, arg.Type())
+				}
+				size += len(hash.Pairs)
+			}
+			if errObj := e.alloc(hashSize(size)); errObj != nil {
+				return errObj
+			}
+			merged := object.NewHash(size)
+			for _, arg := range args {
+				hash := arg.(*object.Hash)
+				for _, key := range hash.Keys() {
+					merged.Set(key, hash.Pairs[key])
+				}
+			}
+			return merged
+		},
+	},
+}
+
+func hashKey(obj object.Object) (object.HashKey, *object.Error) {
+	key, ok := obj.(object.Hashable)
+	if !ok {
+		return object.HashKey{}, newError("unusable as hash key: %s", obj.Type())
+	}
+	return key.HashKey(), nil
+}
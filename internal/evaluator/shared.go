@@ -0,0 +1,71 @@
+package evaluator
+
+import "github.com/assimad8/go-interpreter/internal/object"
+
+// The functions below expose the operator semantics to the bytecode vm,
+// both engines have to give the same results and error messages.
+
+func (e *Evaluator) EvalInfix(op string, left, right object.Object) object.Object {
+	return e.evalInfixExpression(op, left, right)
+}
+
+func EvalPrefix(op string, right object.Object) object.Object {
+	return evalPrefixExpression(op, right)
+}
+
+// EvalUpdate applies ++ or -- to current
+func (e *Evaluator) EvalUpdate(op string, current object.Object) object.Object {
+	return e.updateValue(op, current)
+}
+
+func EvalIndex(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// SetIndex stores val at left[index] and returns val
+func (e *Evaluator) SetIndex(left, index, val object.Object) object.Object {
+	return e.setIndex(left, index, val)
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// ForInValues returns the keys and values a for-in loop over iterable
+// visits
+func (e *Evaluator) ForInValues(iterable object.Object, withKey bool) ([]object.Object, []object.Object, *object.Error) {
+	return e.forInValues(iterable, withKey)
+}
+
+// Interpolate joins the texts and values of an interpolated string
+func (e *Evaluator) Interpolate(parts []object.Object) object.Object {
+	return e.interpolate(parts)
+}
+
+// CallBuiltin runs b for another engine, the functions b calls back go to
+// callback
+func (e *Evaluator) CallBuiltin(b *Builtin, args []object.Object, callback func(fn object.Object, args []object.Object) object.Object) object.Object {
+	saved := e.callback
+	e.callback = callback
+	defer func() { e.callback = saved }()
+	return b.Fn(e, args...)
+}
+
+// CallHostBuiltin calls a builtin registered by the embedding program
+func CallHostBuiltin(b *object.Builtin, args []object.Object) object.Object {
+	return callHostBuiltin(b, args)
+}
+
+func LookupBuiltin(name string) (*Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// Throw returns the error a throw statement raises for val
+func Throw(val object.Object) *object.Error {
+	return throw(val)
+}
+
+func NewError(format string, a ...any) *object.Error {
+	return newError(format, a...)
+}
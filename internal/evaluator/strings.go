@@ -0,0 +1,334 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// stringBuiltins work on code points rather than bytes: positions and
+// lengths they take or return count runes. bytes is the way to the UTF-8
+// encoding.
+var stringBuiltins = map[string]*Builtin{
+	"bytes": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("bytes", args, 1, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			s := args[0].(*object.String).Value
+			if errObj := e.alloc(arraySize(len(s))); errObj != nil {
+				return errObj
+			}
+			elements := make([]object.Object, len(s))
+			for i := 0; i < len(s); i++ {
+				elements[i] = &object.Integer{Value: int64(s[i])}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"split": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("split", args, 2, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			s, sep := args[0].(*object.String).Value, args[1].(*object.String).Value
+			var parts []string
+			if sep == "" {
+				parts = splitRunes(s)
+			} else {
+				parts = strings.Split(s, sep)
+			}
+			if errObj := e.alloc(arraySize(len(parts)) + int64(len(parts))*stringSize(0) + int64(len(s))); errObj != nil {
+				return errObj
+			}
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"join": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("join", args, 2, object.ARRAY_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			elements, sep := args[0].(*object.Array).Elements, args[1].(*object.String).Value
+			parts := make([]string, len(elements))
+			size := len(sep) * max(len(elements)-1, 0)
+			for i, el := range elements {
+				str, ok := el.(*object.String)
+				if !ok {
+					return newError("element %d of the array passed to 'join' must be STRING. got=%s", i, el.Type())
+				}
+				parts[i] = str.Value
+				size += len(str.Value)
+			}
+			if errObj := e.alloc(stringSize(size)); errObj != nil {
+				return errObj
+			}
+			return &object.String{Value: strings.Join(parts, sep)}
+		},
+	},
+	"trim": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("trim", args, 1, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			s := args[0].(*object.String).Value
+			if len(args) == 2 {
+				return e.newString(strings.Trim(s, args[1].(*object.String).Value))
+			}
+			return e.newString(strings.TrimSpace(s))
+		},
+	},
+	"upper": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("upper", args, 1, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			return e.newString(strings.ToUpper(args[0].(*object.String).Value))
+		},
+	},
+	"lower": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("lower", args, 1, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			return e.newString(strings.ToLower(args[0].(*object.String).Value))
+		},
+	},
+	"contains": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("contains", args, 2, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			return nativeBoolToBooleanObject(strings.Contains(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	"index_of": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("index_of", args, 2, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			s := args[0].(*object.String).Value
+			i := strings.Index(s, args[1].(*object.String).Value)
+			if i < 0 {
+				return &object.Integer{Value: -1}
+			}
+			return &object.Integer{Value: int64(utf8.RuneCountInString(s[:i]))}
+		},
+	},
+	"replace": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("replace", args, 3, object.STRING_OBJ, object.STRING_OBJ, object.STRING_OBJ, object.INTEGER_OBJ); errObj != nil {
+				return errObj
+			}
+			s, old, repl := args[0].(*object.String).Value, args[1].(*object.String).Value, args[2].(*object.String).Value
+			n := -1 // all of them
+			if len(args) == 4 {
+				n = int(args[3].(*object.Integer).Value)
+			}
+			// only a longer replacement makes the result grow
+			size := len(s)
+			if len(repl) > len(old) {
+				count := strings.Count(s, old)
+				if n >= 0 && n < count {
+					count = n
+				}
+				size += count * (len(repl) - len(old))
+			}
+			if errObj := e.alloc(stringSize(size)); errObj != nil {
+				return errObj
+			}
+			return &object.String{Value: strings.Replace(s, old, repl, n)}
+		},
+	},
+	"starts_with": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("starts_with", args, 2, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			return nativeBoolToBooleanObject(strings.HasPrefix(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	"ends_with": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("ends_with", args, 2, object.STRING_OBJ, object.STRING_OBJ); errObj != nil {
+				return errObj
+			}
+			return nativeBoolToBooleanObject(strings.HasSuffix(args[0].(*object.String).Value, args[1].(*object.String).Value))
+		},
+	},
+	"substr": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("substr", args, 2, object.STRING_OBJ, object.INTEGER_OBJ, object.INTEGER_OBJ); errObj != nil {
+				return errObj
+			}
+			runes := []rune(args[0].(*object.String).Value)
+			start := args[1].(*object.Integer).Value
+			if start < 0 || start > int64(len(runes)) {
+				return newError("start of 'substr' out of range. got=%d, length=%d", start, len(runes))
+			}
+			end := int64(len(runes))
+			if len(args) == 3 {
+				length := args[2].(*object.Integer).Value
+				if length < 0 {
+					return newError("length of 'substr' must not be negative. got=%d", length)
+				}
+				// compared before adding so a huge length cannot overflow
+				if length < end-start {
+					end = start + length
+				}
+			}
+			return e.newString(string(runes[start:end]))
+		},
+	},
+	"repeat": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if errObj := checkArgs("repeat", args, 2, object.STRING_OBJ, object.INTEGER_OBJ); errObj != nil {
+				return errObj
+			}
+			// the same rules as string * integer
+			return e.evalStringInfixExpression("*", args[0], args[1])
+		},
+	},
+	"format": {
+		Fn: func(e *Evaluator, args ...object.Object) object.Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want>=1", len(args))
+			}
+			layout, ok := args[0].(*object.String)
+			if !ok {
+				return newError("argument 1 to 'format' must be STRING. got=%s", args[0].Type())
+			}
+			s, errObj := format(layout.Value, args[1:])
+			if errObj != nil {
+				return errObj
+			}
+			return e.newString(s)
+		},
+	},
+}
+
+// checkArgs checks the number and the types of the arguments of the
+// builtin name. It takes at least required arguments and at most one per
+// type, the ones after required are optional. An empty type takes any
+// value and FUNCTION takes builtins too.
+func checkArgs(name string, args []object.Object, required int, types ...object.ObjectType) *object.Error {
+	if len(args) < required || len(args) > len(types) {
+		if required == len(types) {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), required)
+		}
+		return newError("wrong number of arguments. got=%d, want=%d..%d", len(args), required, len(types))
+	}
+	for i, arg := range args {
+		switch {
+		case types[i] == "", arg.Type() == types[i]:
+			continue
+		case types[i] == object.FUNCTION_OBJ && arg.Type() == object.BUILTIN_OBJ:
+			continue
+		}
+		if len(types) == 1 {
+			return newError("argument to '%s' must be %s. got=%s", name, types[i], arg.Type())
+		}
+		return newError("argument %d to '%s' must be %s. got=%s", i+1, name, types[i], arg.Type())
+	}
+	return nil
+}
+
+// newString charges s against the memory limit and wraps it
+func (e *Evaluator) newString(s string) object.Object {
+	if errObj := e.alloc(stringSize(len(s))); errObj != nil {
+		return errObj
+	}
+	return &object.String{Value: s}
+}
+
+func splitRunes(s string) []string {
+	parts := make([]string, 0, utf8.RuneCountInString(s))
+	for len(s) > 0 {
+		_, size := utf8.DecodeRuneInString(s)
+		parts = append(parts, s[:size])
+		s = s[size:]
+	}
+	return parts
+}
+
+// format implements the format builtin. The verbs are the ones of Go's
+// fmt package that make sense for the values of the language, each one
+// checks the type of its argument: %d, %x, %o, %b and %c take integers,
+// %f, %e and %g numbers, %t booleans, %q strings, %s and %v anything.
+// Flags, width and precision are passed through.
+func format(layout string, args []object.Object) (string, *object.Error) {
+	var out strings.Builder
+	next := 0
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			out.WriteByte(layout[i])
+			continue
+		}
+		start := i
+		i++
+		for i < len(layout) && strings.IndexByte("+-# 0123456789.", layout[i]) >= 0 {
+			i++
+		}
+		if i == len(layout) {
+			return "", newError("format: missing verb at the end of %q", layout)
+		}
+		verb, spec := layout[i], layout[start:i+1]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if next == len(args) {
+			return "", newError("format: missing argument for %s", spec)
+		}
+		arg := args[next]
+		next++
+
+		var value any
+		switch verb {
+		case 'd', 'x', 'X', 'o', 'b', 'c':
+			if n, ok := arg.(*object.Integer); ok {
+				value = n.Value
+			} else if s, ok := arg.(*object.String); ok && (verb == 'x' || verb == 'X') {
+				value = s.Value
+			}
+		case 'f', 'e', 'E', 'g', 'G':
+			switch n := arg.(type) {
+			case *object.Float:
+				value = n.Value
+			case *object.Integer:
+				value = float64(n.Value)
+			}
+		case 't':
+			if b, ok := arg.(*object.Boolean); ok {
+				value = b.Value
+			}
+		case 'q':
+			if s, ok := arg.(*object.String); ok {
+				value = s.Value
+			}
+		case 's', 'v':
+			if s, ok := arg.(*object.String); ok {
+				value = s.Value
+			} else {
+				value = arg.Inspect()
+			}
+			spec = spec[:len(spec)-1] + "s"
+		default:
+			return "", newError("format: unknown verb %s", spec)
+		}
+		if value == nil {
+			return "", newError("format: %s does not take %s", spec, arg.Type())
+		}
+		fmt.Fprintf(&out, spec, value)
+	}
+	if next < len(args) {
+		return "", newError("format: %d arguments given, the layout uses %d", len(args), next)
+	}
+	return out.String(), nil
+}
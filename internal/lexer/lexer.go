@@ -1,35 +1,211 @@
 package lexer
 
-import "github.com/assimad8/go-interpreter/internal/token"
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/token"
+)
+
+// diagnostic codes reported by the lexer
+const (
+	CodeUnterminatedComment = "L001"
+	CodeUnterminatedString  = "L002"
+	CodeInvalidEscape       = "L003"
+)
 
 type Lexer struct {
 	input        string
 	position     int  //current position in input
 	readPosition int  // current position in input after current char
-	ch           byte //current char under examination
+	ch           rune //current char under examination, decoded from UTF-8
+
+	file   string // file name reported in token positions
+	line   int    // line of the current char
+	column int    // column of the current char, in chars rather than bytes
+
+	keepComments bool
+	errors       []*diagnostic.Diagnostic
+
+	tokens []token.Token // replayed instead of reading input, see NewTokens
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a lexer whose token positions carry the given file name
+func NewFile(file string, input string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
+// NewTokens creates a lexer that returns tokens, which end with an EOF,
+// instead of reading input. The parser uses it on the expressions of an
+// interpolated string.
+func NewTokens(tokens []token.Token) *Lexer {
+	return &Lexer{tokens: tokens}
+}
+
+// skipShebang ignores a leading "#!/usr/bin/env ..." line so scripts can
+// be executed directly
+func (lex *Lexer) skipShebang() {
+	if lex.ch != '#' || lex.peekChar() != '!' {
+		return
+	}
+	for lex.ch != '\n' && lex.ch != 0 {
+		lex.readChar()
+	}
+}
+
+// KeepComments makes NextToken attach the comments before each token to
+// its Comments, for tools that have to reproduce them. The parser does
+// not need them.
+func (lex *Lexer) KeepComments() {
+	lex.keepComments = true
+}
+
+// Diagnostics returns the errors of the tokens that could not be read.
+// A comment or a string that is not closed ends the input: the lexer
+// returns EOF at the position it starts, where its error is.
+func (lex *Lexer) Diagnostics() []*diagnostic.Diagnostic {
+	return lex.errors
+}
+
+func (lex *Lexer) error(code string,start,end token.Position,format string,a ...any) *diagnostic.Diagnostic {
+	d := diagnostic.New(code,start,end,format,a...)
+	lex.errors = append(lex.errors,d)
+	return d
+}
+
+// after returns the position right after the current char
+func (lex *Lexer) after() token.Position {
+	p := lex.pos()
+	p.Offset = lex.readPosition
+	p.Column++
+	return p
+}
+
+// readChar decodes the next char, a byte that is not valid UTF-8 is read
+// alone as utf8.RuneError
 func (lex *Lexer) readChar() {
+	if lex.ch == '\n' {
+		lex.line++
+		lex.column = 0
+	}
+	size := 1
 	if lex.readPosition >= len(lex.input) {
 		lex.ch = 0
 	} else {
-		lex.ch = lex.input[lex.readPosition]
+		lex.ch,size = utf8.DecodeRuneInString(lex.input[lex.readPosition:])
+	}
+	if lex.readPosition <= len(lex.input) {
+		lex.position = lex.readPosition
+		lex.readPosition += size
+		lex.column++
+	}
+}
+
+// pos returns the position of the current char
+func (lex *Lexer) pos() token.Position {
+	return token.Position{
+		File:   lex.file,
+		Offset: lex.position,
+		Line:   lex.line,
+		Column: lex.column,
 	}
-	lex.position = lex.readPosition
-	lex.readPosition++
 }
 
 func (lex *Lexer) NextToken() token.Token {
-	for lex.isSkipped(){
-		lex.readChar()
+	if lex.tokens != nil {
+		tk := lex.tokens[0]
+		// the EOF at the end keeps coming back
+		if len(lex.tokens) > 1 {
+			lex.tokens = lex.tokens[1:]
+		}
+		return tk
+	}
+	comments,illegal := lex.skipTrivia()
+	var tk token.Token
+	if illegal != nil {
+		tk = *illegal
+	}else {
+		tk = lex.readToken()
+	}
+	tk.Comments = comments
+	return tk
+}
+
+// skipTrivia skips the whitespace and the comments before the next token
+// and returns the comments when they are kept. A block comment that is
+// not closed comes back as the EOF token.
+func (lex *Lexer) skipTrivia() ([]token.Comment,*token.Token) {
+	var comments []token.Comment
+	for {
+		for lex.isSkipped(){
+			lex.readChar()
+		}
+		if lex.ch != '/' || lex.peekChar() != '/' && lex.peekChar() != '*' {
+			return comments,nil
+		}
+		comment,closed := lex.readComment()
+		if !closed {
+			opener := comment.Pos
+			opener.Offset += 2
+			opener.Column += 2
+			lex.error(CodeUnterminatedComment,comment.Pos,opener,"block comment is not terminated").
+				Hint("close it with */, comments nest so every /* inside needs one too")
+			return comments,&token.Token{Type: token.EOF,Pos: comment.Pos,End: comment.Pos}
+		}
+		if lex.keepComments {
+			comments = append(comments,comment)
+		}
+	}
+}
+
+// readComment reads a // comment up to the end of the line, or a /* */
+// comment which may contain other block comments. It reports false when
+// the input ends before a block comment is closed.
+func (lex *Lexer) readComment() (token.Comment,bool) {
+	start := lex.pos()
+	closed := true
+	if lex.peekChar() == '/' {
+		for lex.ch != '\n' && lex.ch != 0 {
+			lex.readChar()
+		}
+	}else {
+		depth := 0
+		for {
+			if lex.ch == 0 {
+				closed = false
+				break
+			}
+			if lex.ch == '/' && lex.peekChar() == '*' {
+				depth++
+				lex.readChar()
+			}else if lex.ch == '*' && lex.peekChar() == '/' {
+				depth--
+				lex.readChar()
+			}
+			lex.readChar()
+			if depth == 0 {
+				break
+			}
+		}
 	}
+	end := lex.pos()
+	return token.Comment{Text: lex.input[start.Offset:end.Offset],Pos: start,End: end},closed
+}
+
+// readToken reads the token starting at the current char
+func (lex *Lexer) readToken() token.Token {
 	var tk token.Token
+	start := lex.pos()
 
 	switch lex.ch {
 	case '=':
@@ -45,6 +221,10 @@ func (lex *Lexer) NextToken() token.Token {
 			ch := lex.ch
 			lex.readChar()
 			tk = token.Token{Type: token.PLUS_PLUS, Literal: string(ch) + string(lex.ch)}
+		}else if(lex.peekChar() == '='){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.PLUS_ASSIGN, Literal: string(ch) + string(lex.ch)}
 		}else{
 			tk = newToken(token.PLUS,lex.ch)
 		}
@@ -53,15 +233,31 @@ func (lex *Lexer) NextToken() token.Token {
 			ch := lex.ch
 			lex.readChar()
 			tk = token.Token{Type: token.MINUS_MINUS, Literal: string(ch) + string(lex.ch)}
+		}else if(lex.peekChar() == '='){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.MINUS_ASSIGN, Literal: string(ch) + string(lex.ch)}
 		}else{
 			tk = newToken(token.MINUS,lex.ch)
 		}
 	case ':':
 		tk = newToken(token.COLON,lex.ch)
 	case '*':
-		tk = newToken(token.ASTERISK,lex.ch)
+		if(lex.peekChar() == '='){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.ASTERISK_ASSIGN, Literal: string(ch) + string(lex.ch)}
+		}else{
+			tk = newToken(token.ASTERISK,lex.ch)
+		}
 	case '/':
-		tk = newToken(token.SLASH,lex.ch)
+		if(lex.peekChar() == '='){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.SLASH_ASSIGN, Literal: string(ch) + string(lex.ch)}
+		}else{
+			tk = newToken(token.SLASH,lex.ch)
+		}
 	case '>':
 		if(lex.peekChar()=='='){
 			ch := lex.ch
@@ -86,6 +282,22 @@ func (lex *Lexer) NextToken() token.Token {
 		}else{
 			tk = newToken(token.BANG,lex.ch)
 		}
+	case '&':
+		if(lex.peekChar()=='&'){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.AND, Literal: string(ch) + string(lex.ch)}
+		}else{
+			tk = newToken(token.ILLEGAL,lex.ch)
+		}
+	case '|':
+		if(lex.peekChar()=='|'){
+			ch := lex.ch
+			lex.readChar()
+			tk = token.Token{Type: token.OR, Literal: string(ch) + string(lex.ch)}
+		}else{
+			tk = newToken(token.ILLEGAL,lex.ch)
+		}
 	case ';':
 		tk = newToken(token.SEMICOLON,lex.ch)
 	case ',':
@@ -102,12 +314,28 @@ func (lex *Lexer) NextToken() token.Token {
 		tk = newToken(token.LBRACKET,lex.ch)
 	case ']':
 		tk = newToken(token.RBRACKET,lex.ch)
-	case '"':
-		tk.Type 	= token.STRING
-		tk.Literal	= lex.readString()
-	case '\'':
-		tk.Type 	= token.STRING
-		tk.Literal	= lex.readString()
+	case '"','\'','`':
+		errors := len(lex.errors)
+		value,parts,closed := lex.readString()
+		if !closed {
+			// unless a string in a ${} was the one left open
+			if len(lex.errors) == errors {
+				quote := start
+				quote.Offset++
+				quote.Column++
+				lex.error(CodeUnterminatedString,start,quote,"string literal is not terminated").
+					Hint("close it with %c",lex.input[start.Offset])
+			}
+			return token.Token{Type: token.EOF,Pos: start,End: start}
+		}
+		if parts != nil {
+			tk.Type = token.INTERPOLATED
+			tk.Literal = lex.input[start.Offset:lex.position+1]
+			tk.Parts = parts
+		}else {
+			tk.Type 	= token.STRING
+			tk.Literal	= value
+		}
 	case 0:
 		tk.Literal = ""
 		tk.Type = token.EOF
@@ -115,33 +343,143 @@ func (lex *Lexer) NextToken() token.Token {
 		if isLetter(lex.ch) {
 			tk.Literal = lex.readIdentifier()
 			tk.Type = token.LookupIden(tk.Literal)
+			tk.Pos, tk.End = start, lex.pos()
 			return tk
 		}else if isNumber(lex.ch){
-			tk.Type = token.INT
-			tk.Literal = lex.readNumber()
+			tk.Literal,tk.Type = lex.readNumber()
+			tk.Pos, tk.End = start, lex.pos()
 			return tk
 		}else{
-			tk = newToken(token.ILLEGAL,lex.ch)
+			tk = token.Token{Type: token.ILLEGAL,Literal: lex.input[lex.position:lex.readPosition]}
 		}
 	}
 	lex.readChar()
+	tk.Pos, tk.End = start, lex.pos()
 	return tk
 }
 
-func newToken(tokenType token.TokenType,ch byte) token.Token {
+func newToken(tokenType token.TokenType,ch rune) token.Token {
 	return token.Token{Type:tokenType,Literal:string(ch)}
 }
 
-func (lex *Lexer) readString() string {
-	position := lex.position+1
-	char := lex.ch
+// readString reads the literal the current quote opens and returns its
+// value, or its parts when it embeds expressions with ${}. The current
+// char is then the closing quote. Backquoted strings are raw, the others
+// may span lines too but decode escapes and interpolate. It reports false
+// when the input ends first.
+func (lex *Lexer) readString() (string,[]token.Part,bool) {
+	quote := lex.ch
+	var out strings.Builder
+	var parts []token.Part
+	lex.readChar()
 	for {
+		switch {
+		case lex.ch == 0:
+			return "",nil,false
+		case lex.ch == quote:
+			if parts == nil {
+				return out.String(),nil,true
+			}
+			return "",append(parts,token.Part{Text: out.String()}),true
+		case lex.ch == '\\' && quote != '`':
+			lex.readEscape(&out)
+		case lex.ch == '$' && lex.peekChar() == '{' && quote != '`':
+			lex.readChar()
+			lex.readChar()
+			tokens,closed := lex.readEmbedded()
+			if !closed {
+				return "",nil,false
+			}
+			parts = append(parts,token.Part{Text: out.String(),Tokens: tokens})
+			out.Reset()
+			continue
+		default:
+			// the bytes as they are, even when they are not valid UTF-8
+			out.WriteString(lex.input[lex.position:lex.readPosition])
+		}
 		lex.readChar()
-		if lex.ch == char || lex.ch == 0 {
-			break
+	}
+}
+
+// readEmbedded reads the tokens of the expression in a ${}, starting at
+// the char after ${. They end with an EOF at the closing brace, the
+// current char is then the one after it. It reports false when the input
+// ends first.
+func (lex *Lexer) readEmbedded() ([]token.Token,bool) {
+	var tokens []token.Token
+	depth := 0
+	for {
+		tk := lex.NextToken()
+		switch tk.Type {
+		case token.EOF:
+			return nil,false
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return append(tokens,token.Token{Type: token.EOF,Pos: tk.Pos,End: tk.Pos,Comments: tk.Comments}),true
+			}
+			depth--
 		}
+		tokens = append(tokens,tk)
+	}
+}
+
+// escapes are the one char escape sequences and what they stand for
+var escapes = map[rune]byte{
+	'n': '\n',
+	't': '\t',
+	'r': '\r',
+	'\\': '\\',
+	'"': '"',
+	'\'': '\'',
+	'`': '`',
+	'$': '$',
+}
+
+// readEscape decodes the escape sequence starting at the current
+// backslash into out, the current char is then its last one
+func (lex *Lexer) readEscape(out *strings.Builder) {
+	start := lex.pos()
+	lex.readChar()
+	if ch,ok := escapes[lex.ch]; ok {
+		out.WriteByte(ch)
+		return
+	}
+	switch lex.ch {
+	case 0:
+		// the string is not terminated, which readString reports
+	case 'u':
+		if lex.peekChar() != '{' {
+			lex.error(CodeInvalidEscape,start,lex.after(),"invalid Unicode escape").
+				Hint("write the code point in hex between braces, like \\u{e9}")
+			return
+		}
+		lex.readChar()
+		digits := lex.position+1
+		for isHexDigit(lex.peekChar()) {
+			lex.readChar()
+		}
+		hex := lex.input[digits:lex.position+1]
+		if lex.peekChar() != '}' || len(hex) == 0 || len(hex) > 6 {
+			if lex.peekChar() == '}' {
+				lex.readChar()
+			}
+			lex.error(CodeInvalidEscape,start,lex.after(),"invalid Unicode escape").
+				Hint("write 1 to 6 hex digits between braces, like \\u{e9}")
+			return
+		}
+		lex.readChar()
+		code,_ := strconv.ParseUint(hex,16,32)
+		if !utf8.ValidRune(rune(code)) {
+			lex.error(CodeInvalidEscape,start,lex.after(),"invalid Unicode code point U+%s",strings.ToUpper(hex))
+			return
+		}
+		out.WriteRune(rune(code))
+	default:
+		lex.error(CodeInvalidEscape,start,lex.after(),"unknown escape sequence \\%c",lex.ch).
+			Hint("the escapes are \\n \\t \\r \\\\ \\\" \\' \\` \\$ and \\u{...}")
 	}
-	return lex.input[position:lex.position]
 }
 
 func (lex *Lexer) readIdentifier() string {
@@ -151,19 +489,64 @@ func (lex *Lexer) readIdentifier() string {
 	}
 	return lex.input[position:lex.position]
 }
-func (lex *Lexer) readNumber() string {
+// readNumber reads an INT, or a FLOAT when a fraction or an exponent
+// follows the digits: 3.14, 1e9, 2.5E-3. Integers may also be written in
+// hex, octal or binary with 0x, 0o and 0b, and _ may separate digits:
+// 1_000_000, 0xff_ff. The parser checks where the _ are.
+func (lex *Lexer) readNumber() (string,token.TokenType) {
 	position := lex.position
-	for isNumber(lex.ch){
+	tokenType := token.TokenType(token.INT)
+	if lex.ch == '0' && strings.ContainsRune("xXoObB",lex.peekChar()) {
+		lex.readChar()
+		lex.readChar()
+		for isHexDigit(lex.ch) || lex.ch == '_' {
+			lex.readChar()
+		}
+		return lex.input[position:lex.position],tokenType
+	}
+	lex.readDigits()
+
+	if lex.ch == '.' && isNumber(lex.peekChar()) {
+		tokenType = token.FLOAT
 		lex.readChar()
+		lex.readDigits()
 	}
-	return lex.input[position:lex.position]
+	if lex.ch == 'e' || lex.ch == 'E' {
+		// 1e is the number 1 followed by the identifier e
+		next := lex.peekChar()
+		if isNumber(next) || (next == '+' || next == '-') && isNumber(lex.peekCharAt(2)) {
+			tokenType = token.FLOAT
+			lex.readChar()
+			if lex.ch == '+' || lex.ch == '-' {
+				lex.readChar()
+			}
+			lex.readDigits()
+		}
+	}
+	return lex.input[position:lex.position],tokenType
 }
 
-func (lex *Lexer) peekChar() byte {
-	if(lex.readPosition>=len(lex.input)){
-		return 0
+func (lex *Lexer) readDigits() {
+	for isNumber(lex.ch) || lex.ch == '_' {
+		lex.readChar()
+	}
+}
+
+func (lex *Lexer) peekChar() rune {
+	return lex.peekCharAt(1)
+}
+
+// peekCharAt looks n chars ahead of the current one without consuming
+func (lex *Lexer) peekCharAt(n int) rune {
+	position := lex.readPosition
+	for ; position < len(lex.input); n-- {
+		ch,size := utf8.DecodeRuneInString(lex.input[position:])
+		if n == 1 {
+			return ch
+		}
+		position += size
 	}
-	return lex.input[lex.readPosition]
+	return 0
 }
 
 func (lex *Lexer) isSkipped() bool {
@@ -173,9 +556,15 @@ func (lex *Lexer) isSkipped() bool {
 	return false
 }
 
-func isLetter(ch byte) bool {
-	return 'a'<= ch && ch <= 'z' || 'A'<= ch && ch <= 'Z' || ch == '_'
+// isLetter accepts the letters of any script, so identifiers can be
+// written in the language of the program
+func isLetter(ch rune) bool {
+	return 'a'<= ch && ch <= 'z' || 'A'<= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+func isHexDigit(ch rune) bool {
+	return isNumber(ch) || 'a'<= ch && ch <= 'f' || 'A'<= ch && ch <= 'F'
 }
-func isNumber(ch byte) bool {
+func isNumber(ch rune) bool {
 	return '0'<= ch && ch <= '9'
 }
\ No newline at end of file
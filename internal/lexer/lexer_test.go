@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/assimad8/go-interpreter/internal/token"
@@ -24,6 +25,9 @@ func TestNextToken(t *testing.T) {
 	10 <= 9
 	9++
 	9--
+	x += 1 -= 2 *= 3 /= 4
+	a && b || c and d or e
+	3.14 1e9 2.5E-3 1e x.5 7.
 	"foobar"
 	"foo bar"
 	[1,2];
@@ -107,6 +111,34 @@ func TestNextToken(t *testing.T) {
 		{token.PLUS_PLUS, "++"},
 		{token.INT, "9"},
 		{token.MINUS_MINUS, "--"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.AND, "and"},
+		{token.IDENT, "d"},
+		{token.OR, "or"},
+		{token.IDENT, "e"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "2.5E-3"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "."},
+		{token.INT, "5"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
 		{token.STRING, "foobar"},
 		{token.STRING, "foo bar"},
 		{token.LBRACKET, "["},
@@ -137,3 +169,327 @@ func TestNextToken(t *testing.T) {
 	}
 }
 
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"ab\""
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedLine int
+		expectedColumn int
+		expectedEndColumn int
+	}{
+		{token.LET, 1, 1, 4},
+		{token.IDENT, 1, 5, 6},
+		{token.ASSIGN, 1, 7, 8},
+		{token.INT, 1, 9, 10},
+		{token.SEMICOLON, 1, 10, 11},
+		{token.IDENT, 2, 3, 4},
+		{token.PLUS, 2, 5, 6},
+		{token.STRING, 2, 7, 11},
+		{token.EOF, 2, 11, 11},
+	}
+
+	l := NewFile("main.mk", input)
+
+	for i,tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - tokentype wrong,expected=%q, got=%q",i,tt.expectedType,tok.Type)
+		}
+		if tok.Pos.File != "main.mk" {
+			t.Fatalf("test[%d] - file wrong,expected=%q, got=%q",i,"main.mk",tok.Pos.File)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("test[%d] - position wrong,expected=%d:%d, got=%d:%d",i,tt.expectedLine,tt.expectedColumn,tok.Pos.Line,tok.Pos.Column)
+		}
+		if tok.End.Line != tt.expectedLine || tok.End.Column != tt.expectedEndColumn {
+			t.Fatalf("test[%d] - end position wrong,expected=%d:%d, got=%d:%d",i,tt.expectedLine,tt.expectedEndColumn,tok.End.Line,tok.End.Column)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let größe = \"çà\xff\";\nlet 名前 = größe;\xff €"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{token.LET, "let", 1, 1, 0},
+		{token.IDENT, "größe", 1, 5, 4},
+		{token.ASSIGN, "=", 1, 11, 12},
+		{token.STRING, "çà\xff", 1, 13, 14},
+		{token.SEMICOLON, ";", 1, 18, 21},
+		{token.LET, "let", 2, 1, 23},
+		{token.IDENT, "名前", 2, 5, 27},
+		{token.ASSIGN, "=", 2, 8, 34},
+		{token.IDENT, "größe", 2, 10, 36},
+		{token.SEMICOLON, ";", 2, 15, 43},
+		// a byte that is not UTF-8 and a symbol are not letters
+		{token.ILLEGAL, "\xff", 2, 16, 44},
+		{token.ILLEGAL, "€", 2, 18, 46},
+		{token.EOF, "", 2, 19, 49},
+	}
+
+	l := New(input)
+	for i,tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - wrong token. expected=%s %q, got=%s %q",i,tt.expectedType,tt.expectedLiteral,tok.Type,tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn || tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("test[%d] - position wrong,expected=%d:%d @%d, got=%d:%d @%d",i,
+				tt.expectedLine,tt.expectedColumn,tt.expectedOffset,tok.Pos.Line,tok.Pos.Column,tok.Pos.Offset)
+		}
+	}
+}
+
+func TestNumberFormats(t *testing.T) {
+	input := "0xFF_ff 0o17 0B101 1_000 1_000.5 2e1_0 0x1g 1_ 0b"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF_ff"},
+		{token.INT, "0o17"},
+		{token.INT, "0B101"},
+		{token.INT, "1_000"},
+		{token.FLOAT, "1_000.5"},
+		{token.FLOAT, "2e1_0"},
+		// a letter that is not a digit ends the number
+		{token.INT, "0x1"},
+		{token.IDENT, "g"},
+		// the parser reports misplaced _ and missing digits
+		{token.INT, "1_"},
+		{token.INT, "0b"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i,tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - wrong token. expected=%s %q, got=%s %q",i,tt.expectedType,tt.expectedLiteral,tok.Type,tok.Literal)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env go-interpreter run\nlet x = 1;"
+
+	l := New(input)
+	tok := l.NextToken()
+
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong,expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Fatalf("position wrong,expected=2:1, got=%d:%d", tok.Pos.Line, tok.Pos.Column)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still comment */ x / 2
+/**/x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.LET, "let", 2},
+		{token.IDENT, "x", 2},
+		{token.ASSIGN, "=", 2},
+		{token.INT, "5", 2},
+		{token.SEMICOLON, ";", 2},
+		{token.IDENT, "x", 3},
+		{token.SLASH, "/", 3},
+		{token.INT, "2", 3},
+		{token.IDENT, "x", 4},
+		{token.EOF, "", 4},
+	}
+
+	l := New(input)
+	for i,tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] - wrong token,expected=%q %q, got=%q %q",i,tt.expectedType,tt.expectedLiteral,tok.Type,tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine {
+			t.Fatalf("test[%d] - line wrong,expected=%d, got=%d",i,tt.expectedLine,tok.Pos.Line)
+		}
+		if tok.Comments != nil {
+			t.Fatalf("test[%d] - comments kept without KeepComments. got=%+v",i,tok.Comments)
+		}
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Fatalf("unexpected lexer errors: %+v",l.Diagnostics())
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	input := "// one\n/* two */ x // three"
+
+	l := New(input)
+	l.KeepComments()
+
+	tok := l.NextToken()
+	if tok.Type != token.IDENT || len(tok.Comments) != 2 {
+		t.Fatalf("expected IDENT with 2 comments. got=%q with %+v",tok.Type,tok.Comments)
+	}
+	if tok.Comments[0].Text != "// one" || tok.Comments[1].Text != "/* two */" {
+		t.Errorf("wrong comment texts. got=%q, %q",tok.Comments[0].Text,tok.Comments[1].Text)
+	}
+	if c := tok.Comments[1]; c.Pos.Line != 2 || c.Pos.Column != 1 || c.End.Column != 10 {
+		t.Errorf("wrong comment span. got=%s-%s",c.Pos,c.End)
+	}
+
+	tok = l.NextToken()
+	if tok.Type != token.EOF || len(tok.Comments) != 1 || tok.Comments[0].Text != "// three" {
+		t.Errorf("expected the trailing comment on EOF. got=%q with %+v",tok.Type,tok.Comments)
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	input := "x /* open /* nested */\nstill open"
+
+	l := New(input)
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.EOF || tok.Pos.Column != 3 {
+		t.Fatalf("expected EOF where the comment starts. got=%q at %s",tok.Type,tok.Pos)
+	}
+	if tok = l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("expected EOF after the comment. got=%q",tok.Type)
+	}
+
+	diags := l.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 lexer error. got=%d",len(diags))
+	}
+	d := diags[0]
+	if d.Code != CodeUnterminatedComment || d.Span.Start.Column != 3 || d.Span.End.Column != 5 {
+		t.Errorf("wrong diagnostic. got=%s %s-%s %q",d.Code,d.Span.Start,d.Span.End,d.Message)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"say \"hi\" \\ done"`, `say "hi" \ done`},
+		{`'it\'s'`, "it's"},
+		{`"caf\u{e9} \u{1F600}"`, "café \U0001F600"},
+		{"\"two\nlines\"", "two\nlines"},
+		{"`raw \\n ${x} \"q\" 'q'\nsecond line`", "raw \\n ${x} \"q\" 'q'\nsecond line"},
+		{`""`, ""},
+	}
+
+	for _,tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.STRING || tok.Literal != tt.expected {
+			t.Errorf("%s: wrong token. expected=STRING %q, got=%s %q",tt.input,tt.expected,tok.Type,tok.Literal)
+		}
+		if len(l.Diagnostics()) != 0 {
+			t.Errorf("%s: unexpected lexer errors: %s",tt.input,l.Diagnostics()[0].Message)
+		}
+		if tok = l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%s: expected EOF after the string. got=%q",tt.input,tok.Type)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"a ${x + 1}b${ {"k": "}"}["k"] }" '${y}' "\${z}"`
+
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != token.INTERPOLATED || tok.Literal != input[:33] {
+		t.Fatalf("wrong token. expected=INTERPOLATED %q, got=%s %q",input[:33],tok.Type,tok.Literal)
+	}
+	expected := []struct {
+		text   string
+		tokens string
+	}{
+		{"a ", "IDENT + INT OEF"},
+		{"b", "{ STRING : STRING } [ STRING ] OEF"},
+		{"", ""},
+	}
+	if len(tok.Parts) != len(expected) {
+		t.Fatalf("wrong number of parts. expected=%d, got=%d",len(expected),len(tok.Parts))
+	}
+	for i,part := range tok.Parts {
+		var types []string
+		for _,tk := range part.Tokens {
+			types = append(types,string(tk.Type))
+		}
+		if part.Text != expected[i].text || strings.Join(types," ") != expected[i].tokens {
+			t.Errorf("wrong part %d. expected=%q %q, got=%q %q",i,expected[i].text,expected[i].tokens,part.Text,strings.Join(types," "))
+		}
+	}
+	// the EOF ending the tokens is at the closing brace
+	if end := tok.Parts[0].Tokens[3].Pos; end.Column != 11 {
+		t.Errorf("wrong position of the end of the first part. got=%d",end.Column)
+	}
+
+	tok = l.NextToken()
+	if tok.Type != token.INTERPOLATED || len(tok.Parts) != 2 {
+		t.Errorf("single quotes do not interpolate. got=%s %d parts",tok.Type,len(tok.Parts))
+	}
+	tok = l.NextToken()
+	if tok.Type != token.STRING || tok.Literal != "${z}" {
+		t.Errorf("escaped $ interpolates. got=%s %q",tok.Type,tok.Literal)
+	}
+	if tok = l.NextToken(); tok.Type != token.EOF || len(l.Diagnostics()) != 0 {
+		t.Errorf("expected EOF and no errors. got=%s, %d errors",tok.Type,len(l.Diagnostics()))
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		code          string
+		message       string
+		startColumn   int
+		endColumn     int
+	}{
+		{`x = "open`, CodeUnterminatedString, "string literal is not terminated", 5, 6},
+		{"`open\nraw", CodeUnterminatedString, "string literal is not terminated", 1, 2},
+		{`"ends in \"`, CodeUnterminatedString, "string literal is not terminated", 1, 2},
+		{`"a\qb"`, CodeInvalidEscape, "unknown escape sequence \\q", 3, 5},
+		{`"\u00e9"`, CodeInvalidEscape, "invalid Unicode escape", 2, 4},
+		{`"\u{}"`, CodeInvalidEscape, "invalid Unicode escape", 2, 6},
+		{`"\u{1234567}"`, CodeInvalidEscape, "invalid Unicode escape", 2, 13},
+		{`"\u{D800}"`, CodeInvalidEscape, "invalid Unicode code point U+D800", 2, 10},
+		{`"a ${x`, CodeUnterminatedString, "string literal is not terminated", 1, 2},
+		{`"a ${"b}"`, CodeUnterminatedString, "string literal is not terminated", 1, 2},
+		{`"a ${f("b)}`, CodeUnterminatedString, "string literal is not terminated", 8, 9},
+	}
+
+	for _,tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		diags := l.Diagnostics()
+		if len(diags) != 1 {
+			t.Errorf("%s: expected 1 lexer error. got=%d",tt.input,len(diags))
+			continue
+		}
+		d := diags[0]
+		if d.Code != tt.code || d.Message != tt.message || d.Span.Start.Column != tt.startColumn || d.Span.End.Column != tt.endColumn {
+			t.Errorf("%s: wrong error. expected=%s %q %d-%d, got=%s %q %d-%d",tt.input,
+				tt.code,tt.message,tt.startColumn,tt.endColumn,
+				d.Code,d.Message,d.Span.Start.Column,d.Span.End.Column)
+		}
+	}
+}
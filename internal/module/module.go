@@ -0,0 +1,165 @@
+// Package module finds and loads the files of import statements. Both
+// engines share it: a Loader evaluates each module once and serves later
+// imports of the same file from its cache.
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+)
+
+// Ext is added to import paths that have no extension
+const Ext = ".mk"
+
+// Runner evaluates the program of a module and fills mod.Exports, each
+// engine brings its own
+type Runner func(mod *object.Module, program *ast.Program) *object.Error
+
+// Loader resolves imports and caches the modules it evaluated. It is not
+// safe for concurrent use.
+type Loader struct {
+	// directories searched, in order, after the one of the importing
+	// script
+	SearchPath []string
+
+	modules map[string]*object.Module // by absolute path
+	sources map[string]string         // by the path used in positions
+	loading []loading                 // the imports being evaluated, outermost first
+}
+
+type loading struct {
+	key  string // absolute path
+	file string
+}
+
+func NewLoader(searchPath []string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		modules:    map[string]*object.Module{},
+		sources:    map[string]string{},
+	}
+}
+
+// Resolve returns the file path imports from the script from. A path
+// starting with ./ or ../ is only looked up next to the script, other
+// relative paths are then looked up in the search path.
+func (l *Loader) Resolve(from, path string) (string, error) {
+	name := filepath.FromSlash(path)
+	if filepath.Ext(name) == "" {
+		name += Ext
+	}
+
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = []string{name}
+	} else {
+		candidates = []string{filepath.Join(filepath.Dir(from), name)}
+		if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+			for _, dir := range l.SearchPath {
+				candidates = append(candidates, filepath.Join(dir, name))
+			}
+		}
+	}
+	for _, file := range candidates {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find module %q, looked for %s", path, strings.Join(candidates, ", "))
+}
+
+// Load returns the module path imports from the script from, run
+// evaluates it the first time. Importing a module whose evaluation is
+// still running is a cycle and fails.
+func (l *Loader) Load(from, path string, run Runner) (*object.Module, *object.Error) {
+	file, err := l.Resolve(from, path)
+	if err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+	if mod, ok := l.modules[key]; ok {
+		return mod, nil
+	}
+
+	n := len(l.loading)
+	defer func() { l.loading = l.loading[:n] }()
+	// the main script starts the chain so importing it back is a cycle
+	if n == 0 && from != "" {
+		if abs, err := filepath.Abs(from); err == nil {
+			l.loading = append(l.loading, loading{key: abs, file: from})
+		}
+	}
+	for i, entry := range l.loading {
+		if entry.key == key {
+			chain := make([]string, 0, len(l.loading)-i+1)
+			for _, entry := range l.loading[i:] {
+				chain = append(chain, entry.file)
+			}
+			chain = append(chain, file)
+			return nil, &object.Error{Message: "import cycle: " + strings.Join(chain, " -> ")}
+		}
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, &object.Error{Message: err.Error()}
+	}
+	l.sources[file] = string(src)
+	p := parser.New(lexer.NewFile(file, string(src)))
+	program := p.ParseProgram()
+	if diags := p.Diagnostics(); len(diags) != 0 {
+		return nil, Error(diags[0])
+	}
+
+	mod := &object.Module{
+		Name:    strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		Path:    file,
+		Exports: map[string]object.Object{},
+	}
+	l.loading = append(l.loading, loading{key: key, file: file})
+	if errObj := run(mod, program); errObj != nil {
+		return nil, errObj
+	}
+	l.modules[key] = mod
+	return mod, nil
+}
+
+// Source returns the source of a loaded module, file is the path its
+// positions refer to
+func (l *Loader) Source(file string) (string, bool) {
+	src, ok := l.sources[file]
+	return src, ok
+}
+
+// Exports lists the names program exports
+func Exports(program *ast.Program) []string {
+	var names []string
+	for _, stmt := range program.Statements {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			names = append(names, export.Statement.Name.Value)
+		}
+	}
+	return names
+}
+
+// Error turns the diagnostic of a module that does not parse or compile
+// into the error of its import
+func Error(d *diagnostic.Diagnostic) *object.Error {
+	return &object.Error{Message: d.Message, Code: d.Code, Pos: d.Span.Start, End: d.Span.End}
+}
+
+// Frame is the stack frame of a module evaluated for the import at call
+func Frame(mod *object.Module, call diagnostic.Span) diagnostic.StackFrame {
+	return diagnostic.StackFrame{Function: "<module " + mod.Name + ">", Call: call}
+}
@@ -0,0 +1,125 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// writeFiles creates the files under dir, names use forward slashes
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app/main.mk":     "",
+		"app/util.mk":     "",
+		"app/lib/math.mk": "",
+		"std/strings.mk":  "",
+		"std/util.mk":     "",
+	})
+	main := filepath.Join(dir, "app", "main.mk")
+	l := NewLoader([]string{filepath.Join(dir, "std")})
+
+	tests := []struct {
+		path     string
+		expected string // relative to dir, empty when not found
+	}{
+		{"util", "app/util.mk"},
+		{"./util.mk", "app/util.mk"},
+		{"lib/math", "app/lib/math.mk"},
+		{"strings", "std/strings.mk"},
+		{"./strings", ""},
+		{"missing", ""},
+		{filepath.Join(dir, "std", "strings"), "std/strings.mk"},
+	}
+
+	for _, tt := range tests {
+		file, err := l.Resolve(main, tt.path)
+		if tt.expected == "" {
+			if err == nil || !strings.Contains(err.Error(), "cannot find module") {
+				t.Errorf("expected %q not to be found. got=%q, %v", tt.path, file, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("cannot resolve %q: %s", tt.path, err)
+			continue
+		}
+		if expected := filepath.Join(dir, filepath.FromSlash(tt.expected)); file != expected {
+			t.Errorf("wrong file for %q. expected=%q, got=%q", tt.path, expected, file)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.mk":   "",
+		"lib.mk":    "export let x = 1; let hidden = 2;",
+		"a.mk":      `import "b";`,
+		"b.mk":      `import "a";`,
+		"broken.mk": "let = 1;",
+	})
+	main := filepath.Join(dir, "main.mk")
+	l := NewLoader(nil)
+
+	runs := 0
+	var run Runner
+	run = func(mod *object.Module, program *ast.Program) *object.Error {
+		runs++
+		for _, name := range Exports(program) {
+			mod.Exports[name] = &object.Integer{Value: 1}
+		}
+		// follow the imports of the module like an engine would
+		for _, stmt := range program.Statements {
+			if is, ok := stmt.(*ast.ImportStatement); ok {
+				if _, errObj := l.Load(mod.Path, is.Path.Value, run); errObj != nil {
+					return errObj
+				}
+			}
+		}
+		return nil
+	}
+
+	first, errObj := l.Load(main, "lib", run)
+	if errObj != nil {
+		t.Fatalf("cannot load lib: %s", errObj.Message)
+	}
+	second, _ := l.Load(main, "./lib.mk", run)
+	if first != second || runs != 1 {
+		t.Errorf("lib is not cached. same=%t, runs=%d", first == second, runs)
+	}
+	if first.Name != "lib" || len(first.Exports) != 1 || first.Exports["x"] == nil {
+		t.Errorf("wrong module. got=%+v", first)
+	}
+	if src, ok := l.Source(first.Path); !ok || !strings.HasPrefix(src, "export let x") {
+		t.Errorf("source of lib not kept. got=%q", src)
+	}
+
+	_, errObj = l.Load(main, "a", run)
+	expected := "import cycle: " + filepath.Join(dir, "a.mk") + " -> " + filepath.Join(dir, "b.mk") + " -> " + filepath.Join(dir, "a.mk")
+	if errObj == nil || errObj.Message != expected {
+		t.Errorf("expected cycle error %q. got=%+v", expected, errObj)
+	}
+
+	_, errObj = l.Load(main, "broken", run)
+	if errObj == nil || errObj.Code != "P001" || errObj.Pos.File != filepath.Join(dir, "broken.mk") {
+		t.Errorf("expected the parse error of broken.mk. got=%+v", errObj)
+	}
+}
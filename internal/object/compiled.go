@@ -0,0 +1,95 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/token"
+)
+
+const (
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
+)
+
+// SourcePos maps the instructions starting at Offset back to the node
+// they were compiled from
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+	End    token.Position
+}
+
+// CompiledFunction is the bytecode of a function literal, or of a whole
+// program for the main function. Parameters are the first locals.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	LocalNames    []string
+	FreeNames     []string
+	SourceMap     []SourcePos
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	params := cf.LocalNames[:cf.NumParameters]
+	return fmt.Sprintf("fn(%s) { <compiled> }", strings.Join(params, ", "))
+}
+
+// PosAt returns the span of the node the instruction at ip belongs to
+func (cf *CompiledFunction) PosAt(ip int) (token.Position, token.Position) {
+	i := sort.Search(len(cf.SourceMap), func(i int) bool {
+		return cf.SourceMap[i].Offset > ip
+	})
+	if i == 0 {
+		return token.Position{}, token.Position{}
+	}
+	sp := cf.SourceMap[i-1]
+	return sp.Pos, sp.End
+}
+
+// Cell holds a local variable captured by a closure, the defining
+// function and the closure share it so assignments are seen by both
+type Cell struct {
+	Value Object // nil until the variable is defined
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "<unset>"
+	}
+	return c.Value.Inspect()
+}
+
+// Globals are the constants and global variables of a compiled program.
+// A closure keeps the ones of the program that created it, so a function
+// exported by a module still sees the module's variables.
+type Globals struct {
+	Constants []Object
+	Values    []Object // nil until the global is defined
+	Names     []string
+}
+
+// Closure is a compiled function with the variables it captured. To
+// scripts it is a function like any other.
+type Closure struct {
+	Fn      *CompiledFunction
+	Free    []*Cell
+	Globals *Globals
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+	return c.Fn.Inspect()
+}
@@ -36,6 +36,15 @@ func (e *Environment) Set(name string,obj Object) Object {
 	return obj
 }
 
-
-
-
+// Assign rebinds an existing name in the closest environment that
+// defines it, it reports false when the name is not defined
+func (e *Environment) Assign(name string,obj Object) (Object,bool) {
+	if _,ok := e.store[name]; ok {
+		e.store[name] = obj
+		return obj,true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name,obj)
+	}
+	return nil,false
+}
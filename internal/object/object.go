@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/token"
 )
 
 type ObjectType string
@@ -14,6 +18,7 @@ type ObjectType string
 const (
 	STRING_OBJ 			= "STRING"
 	INTEGER_OBJ 		= "INTEGER"
+	FLOAT_OBJ 			= "FLOAT"
 	BOOLEAN_OBJ 		= "BOOLEAN"
 	RETURN_VALUE_OBJ	= "RETURN"
 	ERROR_OBJ			= "ERROR"
@@ -22,6 +27,10 @@ const (
 	ARRAY_OBJ			= "ARRAY"
 	HASH_OBJ			= "HASH"
 	NULL_OBJ 			= "NULL"
+	BREAK_OBJ			= "BREAK"
+	CONTINUE_OBJ		= "CONTINUE"
+	EXCEPTION_OBJ		= "EXCEPTION"
+	MODULE_OBJ			= "MODULE"
 )
 
 type Object interface {
@@ -42,6 +51,24 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+//Float data type
+type Float struct {
+	Value float64
+}
+
+// Inspect prints the shortest form that parses back to the same value,
+// whole numbers keep a ".0" so they don't read as integers
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value,'g',-1,64)
+	if !strings.ContainsAny(s,".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 //Boolean data type
 type Boolean struct {
 	Value bool
@@ -75,21 +102,112 @@ func(r *ReturnVALUE) Inspect() string {
 	return r.Value.Inspect()
 }
 
+// Break and Continue are the signals of the loop control statements,
+// like ReturnVALUE they stop the evaluation of the enclosing blocks
+type Break struct {}
+func(b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func(b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct {}
+func(c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func(c *Continue) Inspect() string {
+	return "continue"
+}
+
 // Error object
 type Error struct {
 	Message string
+	Code    string // diagnostic code, CodeRuntimeError when empty
+	Pos     token.Position // where the error was raised, if known
+	End     token.Position
+	Stack   []diagnostic.StackFrame // the calls running when it was raised
+	Value   Object // the value of a throw statement, nil for runtime errors
 }
 func(e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 func(e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: "+e.Pos.String()+": "+e.Message
+	}
 	return "ERROR: "+e.Message
 }
 
+// runtime errors share the parser diagnostic format
+const (
+	CodeRuntimeError = "R001"
+	CodeCallDepth    = "R002" // too many nested function calls
+	CodeStepLimit    = "R003" // the step budget is used up
+	CodeCanceled     = "R004" // the context was canceled
+	CodeMemoryLimit  = "R005" // the memory limit is used up
+	CodeThrown       = "R006" // raised by a throw statement
+	CodeNesting      = "R007" // expressions and calls nested too deeply
+)
+
+// Catchable reports whether a try statement may catch the error, the
+// limits stop the whole evaluation
+func (e *Error) Catchable() bool {
+	switch e.Code {
+	case CodeCallDepth,CodeStepLimit,CodeCanceled,CodeMemoryLimit,CodeNesting:
+		return false
+	}
+	return true
+}
+
+// Kind names the error for scripts: Error for thrown values and
+// RuntimeError for the errors of the interpreter
+func (e *Error) Kind() string {
+	if e.Value != nil {
+		return "Error"
+	}
+	return "RuntimeError"
+}
+
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	code := e.Code
+	if code == "" {
+		code = CodeRuntimeError
+	}
+	d := diagnostic.New(code, e.Pos, e.End, "%s", e.Message)
+	d.Stack = e.Stack
+	return d
+}
+
+
+// Exception is an error caught by a try statement, scripts read its
+// message, type, stack and thrown value by indexing it
+type Exception struct {
+	Err *Error
+}
+func(e *Exception) Type() ObjectType {
+	return EXCEPTION_OBJ
+}
+func(e *Exception) Inspect() string {
+	return e.Err.Kind()+": "+e.Err.Message
+}
 
+// Module is an imported script, indexing it reads its exports
+type Module struct {
+	Name    string // the file name without directory and extension
+	Path    string // the file it was loaded from
+	Exports map[string]Object
+}
+func(m *Module) Type() ObjectType {
+	return MODULE_OBJ
+}
+func(m *Module) Inspect() string {
+	return "module "+m.Name
+}
 
 //Function object
 type Function struct {
+	Name       string // the name of the let binding it was defined by
 	Parameters []*ast.Identifier
 	Body		*ast.BlockStatement
 	Env         *Environment
@@ -151,18 +269,47 @@ func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 func (a *Array) Inspect() string {
-	var out bytes.Buffer
+	return inspect(a,map[Object]bool{})
+}
 
-	elements := []string{}
+// inspect formats arrays and hashes, seen holds the ones being formatted
+// so a value that contains itself, which index assignment allows, comes
+// out as [...] or {...} instead of recursing forever
+func inspect(obj Object,seen map[Object]bool) string {
+	var out bytes.Buffer
 
-	for _,i := range a.Elements {
-		elements = append(elements,i.Inspect())
+	switch obj := obj.(type) {
+	case *Array:
+		if seen[obj] {
+			return "[...]"
+		}
+		seen[obj] = true
+		defer delete(seen,obj)
+
+		elements := []string{}
+		for _,el := range obj.Elements {
+			elements = append(elements,inspect(el,seen))
+		}
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements,", "))
+		out.WriteString("]")
+	case *Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen,obj)
+
+		pairs := []string{}
+		for _,pair := range obj.Ordered(){
+			pairs = append(pairs, fmt.Sprintf("%s: %s",inspect(pair.Key,seen),inspect(pair.Value,seen)))
+		}
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs,", "))
+		out.WriteString("}")
+	default:
+		return obj.Inspect()
 	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements,", "))
-	out.WriteString("]")
-
 	return out.String()
 }
 
@@ -192,6 +339,14 @@ func (b *Boolean) HashKey() HashKey {
 func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(),Value: uint64(i.Value)}
 }
+// HashKey of an integral float is the key of the integer, 1.0 == 1 so
+// they find the same entry. -0.0 is integral too.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(),Value: math.Float64bits(f.Value)}
+}
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -204,22 +359,82 @@ type HashPair struct {
 	Value 	Object
 }
 
+// Hash keeps its pairs in insertion order: order lists the keys of Pairs
+// in the order they were first set. Change them with Set and Delete so
+// both stay in sync.
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// a deleted key leaves the zero HashKey in order until more than
+	// half of it is deleted, position gives the place of the others
+	order    []HashKey
+	position map[HashKey]int
+	deleted  int
+}
+
+func NewHash(size int) *Hash {
+	return &Hash{
+		Pairs: make(map[HashKey]HashPair,size),
+		order: make([]HashKey,0,size),
+		position: make(map[HashKey]int,size),
+	}
 }
-func (h *Hash) Type() ObjectType {
-	return HASH_OBJ
+
+// Set stores pair under key, a new key goes last and an existing one
+// keeps its place
+func (h *Hash) Set(key HashKey,pair HashPair) {
+	if _,ok := h.Pairs[key]; !ok {
+		if h.position == nil {
+			h.position = map[HashKey]int{}
+		}
+		h.position[key] = len(h.order)
+		h.order = append(h.order,key)
+	}
+	h.Pairs[key] = pair
 }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
 
-	pairs := []string{}
+// Delete removes key and reports whether it was there
+func (h *Hash) Delete(key HashKey) bool {
+	if _,ok := h.Pairs[key]; !ok {
+		return false
+	}
+	delete(h.Pairs,key)
+	h.order[h.position[key]] = HashKey{}
+	delete(h.position,key)
+	h.deleted++
+	if h.deleted > len(h.order)/2 {
+		h.order = h.Keys()
+		for i,k := range h.order {
+			h.position[k] = i
+		}
+		h.deleted = 0
+	}
+	return true
+}
 
-	for _,pair := range h.Pairs{
-		pairs = append(pairs, fmt.Sprintf("%s: %s",pair.Key.Inspect(),pair.Value.Inspect()))
+// Keys returns the keys in insertion order
+func (h *Hash) Keys() []HashKey {
+	keys := make([]HashKey,0,len(h.Pairs))
+	for _,key := range h.order {
+		if key != (HashKey{}) {
+			keys = append(keys,key)
+		}
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs,", "))
-	out.WriteString("}")
-	return out.String()
+	return keys
+}
+
+// Ordered returns the pairs in insertion order
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair,0,len(h.Pairs))
+	for _,key := range h.order {
+		if key != (HashKey{}) {
+			pairs = append(pairs,h.Pairs[key])
+		}
+	}
+	return pairs
+}
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+func (h *Hash) Inspect() string {
+	return inspect(h,map[Object]bool{})
 }
\ No newline at end of file
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 
 func TestStringHashKey(t *testing.T) {
@@ -20,4 +23,104 @@ func TestStringHashKey(t *testing.T) {
 	}
 }
 
+func TestFloatHashKey(t *testing.T) {
+	tests := []struct {
+		float float64
+		key   HashKey
+	}{
+		{1.0,(&Integer{Value: 1}).HashKey()},
+		{-0.0,(&Integer{Value: 0}).HashKey()},
+		{-3.0,(&Integer{Value: -3}).HashKey()},
+		{2.5,HashKey{Type: FLOAT_OBJ,Value: math.Float64bits(2.5)}},
+		{1e300,HashKey{Type: FLOAT_OBJ,Value: math.Float64bits(1e300)}},
+	}
+	for _,tt := range tests {
+		if key := (&Float{Value: tt.float}).HashKey(); key != tt.key {
+			t.Errorf("wrong hash key for %v. want=%+v, got=%+v",tt.float,tt.key,key)
+		}
+	}
+}
+
 
+
+func TestHashOrder(t *testing.T) {
+	h := NewHash(0)
+	set := func(key string,value int64) {
+		k := &String{Value: key}
+		h.Set(k.HashKey(),HashPair{Key: k,Value: &Integer{Value: value}})
+	}
+	set("z",1)
+	set("a",2)
+	set("m",3)
+	set("z",4)
+	if got := h.Inspect(); got != "{z: 4, a: 2, m: 3}" {
+		t.Errorf("wrong order. got=%s",got)
+	}
+
+	if !h.Delete((&String{Value: "a"}).HashKey()) || h.Delete((&String{Value: "a"}).HashKey()) {
+		t.Errorf("Delete should only report the first removal")
+	}
+	set("a",5)
+	if got := h.Inspect(); got != "{z: 4, m: 3, a: 5}" {
+		t.Errorf("wrong order after delete. got=%s",got)
+	}
+	if len(h.Keys()) != len(h.Pairs) {
+		t.Errorf("keys out of sync. keys=%d, pairs=%d",len(h.Keys()),len(h.Pairs))
+	}
+
+	// deleting most keys compacts the order, which must stay right
+	for _,key := range []string{"b","c","d","e","f"} {
+		set(key,0)
+	}
+	for _,key := range []string{"z","b","m","d","e"} {
+		h.Delete((&String{Value: key}).HashKey())
+	}
+	set("g",6)
+	h.Delete((&String{Value: "f"}).HashKey())
+	if got := h.Inspect(); got != "{a: 5, c: 0, g: 6}" {
+		t.Errorf("wrong order after deletes. got=%s",got)
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	arr.Elements = append(arr.Elements,arr)
+	hash := NewHash(0)
+	k := &String{Value: "self"}
+	hash.Set(k.HashKey(),HashPair{Key: k,Value: hash})
+	// a value seen twice without a cycle is printed in full
+	shared := &Array{Elements: []Object{arr,arr,hash}}
+
+	tests := []struct{
+		obj      Object
+		expected string
+	}{
+		{arr,"[1, [...]]"},
+		{hash,"{self: {...}}"},
+		{shared,"[[1, [...]], [1, [...]], {self: {...}}]"},
+	}
+	for _,tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. expected=%s, got=%s",tt.expected,got)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tenth,fifth := 0.1,0.2
+	tests := []struct{
+		value 		float64
+		expected 	string
+	}{
+		{3.14,"3.14"},
+		{2,"2.0"},
+		{-0.5,"-0.5"},
+		{1e21,"1e+21"},
+		{tenth+fifth,"0.30000000000000004"},
+	}
+	for _,tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect wrong. expected=%q, got=%q",tt.expected,got)
+		}
+	}
+}
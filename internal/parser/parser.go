@@ -2,11 +2,15 @@ package parser
 
 import (
 	// "fmt"
+	"errors"
+	"path"
+	"slices"
 	"strconv"
-
-	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
 	"github.com/assimad8/go-interpreter/internal/lexer"
 	"github.com/assimad8/go-interpreter/internal/token"
 )
@@ -14,26 +18,60 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = y
+	LOGICAL_OR  // || or
+	LOGICAL_AND // && and
 	EQUALS      // ==
-	LESSGREATER // < or >
+	LESSGREATER // <, >, <= or >=
 	SUM         // X + X
 	PRODUCT     // X * X
 	PREFIX      //-X or !X
+	POSTFIX     // X++ or X--
 	CALL        // myFunction(x)
 	INDEX        // array[index]
 )
 
+// diagnostic codes reported by the parser
+const (
+	CodeUnexpectedToken = "P001"
+	CodeNoPrefixParse   = "P002"
+	CodeInvalidInteger  = "P003"
+	CodeOutsideLoop     = "P004"
+	CodeInvalidTarget   = "P005"
+	CodeInvalidFloat    = "P006"
+	CodeNotTopLevel     = "P007"
+	CodeInvalidImport   = "P008"
+	CodeInvalidInterpolation = "P009"
+	CodeTooDeep         = "P010"
+)
+
+// MaxNesting bounds how deep expressions and blocks nest, deeper source
+// is reported instead of exhausting the Go stack of the parser or of the
+// engines walking the tree
+const MaxNesting = 10000
+
 var precedences = map[token.TokenType]int{
 	token.EQ    	:	EQUALS,
 	token.NOT_EQ	:	EQUALS,
 	token.LT    	:	LESSGREATER,
 	token.GT    	:	LESSGREATER,
+	token.LT_EQ    	:	LESSGREATER,
+	token.GT_EQ    	:	LESSGREATER,
+	token.AND    	:	LOGICAL_AND,
+	token.OR    	:	LOGICAL_OR,
 	token.PLUS  	:	SUM,
 	token.MINUS 	:	SUM,
 	token.SLASH 	:	PRODUCT,
 	token.ASTERISK  :	PRODUCT,
 	token.LPAREN	:	CALL,
 	token.LBRACKET	:	INDEX,
+	token.ASSIGN		:	ASSIGN,
+	token.PLUS_ASSIGN	:	ASSIGN,
+	token.MINUS_ASSIGN	:	ASSIGN,
+	token.ASTERISK_ASSIGN	:	ASSIGN,
+	token.SLASH_ASSIGN	:	ASSIGN,
+	token.PLUS_PLUS		:	POSTFIX,
+	token.MINUS_MINUS	:	POSTFIX,
 }
 
 type (
@@ -43,10 +81,14 @@ type (
 
 type Parser struct {
 	l         *lexer.Lexer
-	errors    []string
+	errors    []*diagnostic.Diagnostic
 	curToken  token.Token
 	peekToken token.Token
 
+	braceLevel int // number of { minus number of } seen as curToken
+	loopDepth  int // number of loops enclosing the current statement
+	nesting    int // depth of the tree being built, see MaxNesting
+
 	prefixParseFns map[token.TokenType]prefixParseFunc
 	infixParseFns  map[token.TokenType]infixParseFunc
 }
@@ -60,21 +102,25 @@ func (p *Parser) registerInfix(t token.TokenType, fn infixParseFunc) {
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*diagnostic.Diagnostic{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFunc)
 	p.registerPrefix(token.TRUE  ,p.parseBoolean)
 	p.registerPrefix(token.FALSE ,p.parseBoolean)
 	p.registerPrefix(token.IDENT ,p.parseIdentifier)
 	p.registerPrefix(token.INT   ,p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT ,p.parseFloatLiteral)
 	p.registerPrefix(token.BANG  ,p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS ,p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN,p.parseGroupedExpression)
 	p.registerPrefix(token.IF	 ,p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION	 ,p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING	 ,p.parseStringLiteral)
+	p.registerPrefix(token.INTERPOLATED	 ,p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET	 ,p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE	 ,p.parseHashLiteral)
+	p.registerPrefix(token.PLUS_PLUS	 ,p.parsePrefixUpdateExpression)
+	p.registerPrefix(token.MINUS_MINUS	 ,p.parsePrefixUpdateExpression)
 	
 	p.infixParseFns = make(map[token.TokenType]infixParseFunc)
 	p.registerInfix(token.PLUS    ,p.parseInfixExpression)
@@ -85,8 +131,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ  ,p.parseInfixExpression)
 	p.registerInfix(token.LT      ,p.parseInfixExpression)
 	p.registerInfix(token.GT      ,p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ   ,p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ   ,p.parseInfixExpression)
+	p.registerInfix(token.AND     ,p.parseInfixExpression)
+	p.registerInfix(token.OR      ,p.parseInfixExpression)
 	p.registerInfix(token.LPAREN  ,p.parseCallExpression)
 	p.registerInfix(token.LBRACKET,p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN		,p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN	,p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN	,p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN,p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN	,p.parseAssignExpression)
+	p.registerInfix(token.PLUS_PLUS		,p.parsePostfixUpdateExpression)
+	p.registerInfix(token.MINUS_MINUS	,p.parsePostfixUpdateExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -98,22 +155,102 @@ func New(l *lexer.Lexer) *Parser {
 
 // Errors handling in the parser
 func (p *Parser) Errors() []string {
+	errors := make([]string, 0, len(p.errors))
+	for _, d := range p.errors {
+		errors = append(errors, d.Error())
+	}
+	return errors
+}
+
+// Diagnostics returns the parser errors with their codes and spans
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
 	return p.errors
 }
 
-func (p *Parser) noPrefixParseError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse for %s found.", t)
-	p.errors = append(p.errors, msg)
+// bailout is the panic value used to abandon a broken statement
+type bailout struct{}
+
+// fail records d and unwinds to the enclosing parseStatement which
+// resynchronizes, the tokens are left where the error was found
+func (p *Parser) fail(d *diagnostic.Diagnostic) {
+	// where the lexer could not read a token its error says more
+	for _,lexErr := range p.l.Diagnostics() {
+		if d.Span.Start.Offset == lexErr.Span.Start.Offset {
+			d = lexErr
+		}
+	}
+	p.errors = append(p.errors, d)
+	panic(bailout{})
+}
+func (p *Parser) noPrefixParseError(tk token.Token) {
+	d := diagnostic.New(CodeNoPrefixParse, tk.Pos, tk.End, "no prefix parse for %s found.", tk.Type)
+	if tk.Type == token.ILLEGAL {
+		d.Hint("%q is not a valid character here", tk.Literal)
+	} else if _, ok := p.infixParseFns[tk.Type]; ok {
+		d.Hint("an expression is missing before %q", tk.Literal)
+	}
+	p.fail(d)
+}
+// nest goes one level deeper in the tree, callers restore p.nesting
+func (p *Parser) nest() {
+	p.nesting++
+	if p.nesting > MaxNesting {
+		tk := p.curToken
+		p.fail(diagnostic.New(CodeTooDeep, tk.Pos, tk.End, "expression nested too deeply, the limit is %d levels", MaxNesting).
+			Hint("split it with let statements or functions"))
+	}
 }
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s. got=%s", t, p.curToken.Type)
-	p.errors = append(p.errors, msg)
+	tk := p.peekToken
+	p.fail(diagnostic.New(CodeUnexpectedToken, tk.Pos, tk.End, "expected next token to be %s. got=%s", t, tk.Type))
 }
 
 // update the curtoken and peekToken
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceLevel++
+	case token.RBRACE:
+		p.braceLevel--
+	}
+}
+
+// synchronize skips the rest of a broken statement that started at the
+// given brace level. It stops on the first token of the next statement:
+// after a ';', on a statement keyword, or on the '}' closing the
+// enclosing block, so a single mistake yields a single error.
+func (p *Parser) synchronize(level int) {
+	for {
+		switch p.curToken.Type {
+		case token.EOF:
+			return
+		case token.SEMICOLON:
+			if p.braceLevel <= level {
+				p.nextToken()
+				return
+			}
+		case token.RBRACE:
+			if p.braceLevel < level {
+				return
+			}
+		}
+		p.nextToken()
+
+		if p.braceLevel == level && isStatementKeyword(p.curToken.Type) {
+			return
+		}
+	}
+}
+
+func isStatementKeyword(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.TRY, token.THROW, token.IMPORT, token.EXPORT:
+		return true
+	}
+	return false
 }
 
 //helper functions
@@ -163,6 +300,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys,key)
 
 		if !p.peekTokenIs(token.RBRACE)&&!p.expectedPeek(token.COMMA){
 			return nil
@@ -171,6 +309,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectedPeek(token.RBRACE){
 		return nil
 	}
+	hash.Rbrace = p.curToken
 	return hash
 
 }
@@ -178,6 +317,10 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return nil
+	}
+	array.Rbracket = p.curToken
 
 	return array
 }
@@ -193,7 +336,7 @@ func(p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	p.nextToken()
 	list = append(list, p.parseExpression(LOWEST))
 
-	for !p.curTokenIs(end) && p.peekTokenIs(token.COMMA) && !p.peekTokenIs(token.EOF) {
+	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 		list = append(list, p.parseExpression(LOWEST))
@@ -207,6 +350,53 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token:p.curToken,Value: p.curToken.Literal}
 }
 
+// "text ${expr} text", the lexer has already split the string into parts
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	for _,part := range p.curToken.Parts {
+		str.Texts = append(str.Texts,part.Text)
+		if part.Tokens != nil {
+			str.Exprs = append(str.Exprs,p.parseEmbedded(part.Tokens))
+		}
+	}
+	return str
+}
+
+// parseEmbedded parses the tokens of a ${} as one expression with a parser
+// of its own, its first error becomes the error of the string
+func (p *Parser) parseEmbedded(tokens []token.Token) ast.Expression {
+	sub := New(lexer.NewTokens(tokens))
+	sub.nesting = p.nesting
+	if sub.curTokenIs(token.EOF) {
+		tk := sub.curToken
+		p.fail(diagnostic.New(CodeInvalidInterpolation,tk.Pos,tk.End,"missing expression in string interpolation").
+			Hint("write $ as \\$ for a literal ${"))
+	}
+	expr := sub.parseEmbeddedExpression()
+	if len(sub.errors) != 0 {
+		p.fail(sub.errors[0])
+	}
+	return expr
+}
+
+func (p *Parser) parseEmbeddedExpression() (expr ast.Expression) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			expr = nil
+		}
+	}()
+	expr = p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.EOF) {
+		tk := p.peekToken
+		p.fail(diagnostic.New(CodeInvalidInterpolation,tk.Pos,tk.End,"unexpected %s in string interpolation",tk.Type).
+			Hint("a ${} holds a single expression"))
+	}
+	return expr
+}
+
 func (p *Parser) parseHashExpression(left ast.Expression) ast.Expression {
 	return nil
 }
@@ -218,6 +408,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectedPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Rbracket = p.curToken
 
 	return exp
 }
@@ -225,6 +416,10 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token:p.curToken,Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if exp.Arguments == nil {
+		return nil
+	}
+	exp.Rparen = p.curToken
 	return exp
 }
 
@@ -241,7 +436,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue cannot reach the loops around a function
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
@@ -303,17 +502,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func(p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token:p.curToken}
 	block.Statements = []ast.Statement{}
+	defer func(nesting int) { p.nesting = nesting }(p.nesting)
+	p.nest()
 
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+		if stmt == nil {
+			// already moved to the next statement by synchronize
+			continue
 		}
+		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
+	if !p.curTokenIs(token.RBRACE) {
+		tk := p.curToken
+		p.fail(diagnostic.New(CodeUnexpectedToken, tk.Pos, tk.End, "expected next token to be %s. got=%s", token.RBRACE, tk.Type).
+			Hint("the block opened at %s is never closed", block.Token.Pos))
+	}
+	block.Rbrace = p.curToken
 
 	return block
 }
@@ -330,6 +538,294 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectedPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectedPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectedPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForStatement parses both for (x in iterable) and the C-style
+// for (init; condition; post) loops
+func (p *Parser) parseForStatement() ast.Statement {
+	tk := p.curToken
+
+	if !p.expectedPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInStatement(tk)
+	}
+
+	stmt := &ast.ForStatement{Token: tk}
+
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseStatementKind()
+		if !p.curTokenIs(token.SEMICOLON) && !p.expectedPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectedPeek(token.SEMICOLON) {
+		return nil
+	}
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseForPost()
+	}
+	if !p.expectedPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectedPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForPost parses the post clause which is not ended by a ;
+func (p *Parser) parseForPost() ast.Statement {
+	if p.curTokenIs(token.LET) {
+		stmt := &ast.LetStatement{Token: p.curToken}
+		if !p.expectedPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectedPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+		return stmt
+	}
+	return &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseExpression(LOWEST)}
+}
+
+func (p *Parser) parseForInStatement(tk token.Token) *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: tk}
+
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectedPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+	if !p.expectedPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectedPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectedPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	body := p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return body
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	p.checkInLoop()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	p.checkInLoop()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseTryStatement parses try { } catch (e) { } finally { }, one of
+// the catch and finally blocks may be left out
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectedPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectedPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectedPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectedPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectedPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectedPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+	if stmt.Catch == nil && stmt.Finally == nil {
+		tk := p.peekToken
+		p.fail(diagnostic.New(CodeUnexpectedToken, tk.Pos, tk.End, "expected catch or finally after the try block. got=%s", tk.Type))
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseImportStatement parses import "lib"; and
+// import { a, b } from "lib";
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	p.checkTopLevel()
+
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		for !p.peekTokenIs(token.RBRACE) {
+			if !p.expectedPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+			if !p.peekTokenIs(token.RBRACE) && !p.expectedPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.nextToken()
+		if len(stmt.Names) == 0 {
+			tk := p.curToken
+			p.fail(diagnostic.New(CodeInvalidImport, tk.Pos, tk.End, "expected the names to import"))
+		}
+		// from is only a keyword here
+		if tk := p.peekToken; tk.Type != token.IDENT || tk.Literal != "from" {
+			p.fail(diagnostic.New(CodeUnexpectedToken, tk.Pos, tk.End, "expected from after the imported names. got=%s", tk.Type))
+		}
+		p.nextToken()
+	}
+	if !p.expectedPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if len(stmt.Names) == 0 {
+		stmt.Name = strings.TrimSuffix(path.Base(stmt.Path.Value), path.Ext(stmt.Path.Value))
+		if !isIdentifier(stmt.Name) {
+			tk := p.curToken
+			p.fail(diagnostic.New(CodeInvalidImport, tk.Pos, tk.End, "cannot bind module %q to a name", stmt.Path.Value).
+				Hint("import the names it exports with import { ... } from %q", stmt.Path.Value))
+		}
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	p.checkTopLevel()
+
+	if !p.expectedPeek(token.LET) {
+		return nil
+	}
+	stmt.Statement = p.parseLetStatement()
+	return stmt
+}
+
+// checkTopLevel fails for an import or export inside a block, modules
+// only bind names in their own top level scope
+func (p *Parser) checkTopLevel() {
+	if p.braceLevel != 0 {
+		tk := p.curToken
+		p.fail(diagnostic.New(CodeNotTopLevel, tk.Pos, tk.End, "%s is only allowed at the top level", tk.Literal))
+	}
+}
+
+// isIdentifier reports whether name lexes as a single identifier
+func isIdentifier(name string) bool {
+	if name == "" || token.LookupIden(name) != token.IDENT {
+		return false
+	}
+	// the letters of the lexer
+	for _,ch := range name {
+		if !(ch == '_' || unicode.IsLetter(ch)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Parser) checkInLoop() {
+	if p.loopDepth == 0 {
+		tk := p.curToken
+		p.fail(diagnostic.New(CodeOutsideLoop, tk.Pos, tk.End, "%s outside of a loop", tk.Literal))
+	}
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
@@ -337,7 +833,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -357,7 +853,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 	
-	for !p.curTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
@@ -375,16 +871,45 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token:p.curToken}
 
+	// ParseInt would read 010 as octal while 010.0 is ten
+	if s := p.curToken.Literal; len(s) > 1 && s[0] == '0' && ('0' <= s[1] && s[1] <= '9' || s[1] == '_') {
+		tk := p.curToken
+		p.fail(diagnostic.New(CodeInvalidInteger, tk.Pos, tk.End, "could not parse %q as integer", tk.Literal).
+			Hint("integers do not start with 0, octal ones start with 0o as in 0o17"))
+		return nil
+	}
 	value ,err := strconv.ParseInt(p.curToken.Literal,0,64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer",p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		tk := p.curToken
+		d := diagnostic.New(CodeInvalidInteger, tk.Pos, tk.End, "could not parse %q as integer", tk.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			d.Hint("integers are 64 bits, the largest literal is 9223372036854775807")
+		} else if strings.Contains(tk.Literal, "_") {
+			d.Hint("_ only goes between two digits")
+		}
+		p.fail(d)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token:p.curToken}
+
+	value ,err := strconv.ParseFloat(p.curToken.Literal,64)
+	if err != nil {
+		tk := p.curToken
+		d := diagnostic.New(CodeInvalidFloat, tk.Pos, tk.End, "could not parse %q as float", tk.Literal)
+		if strings.Contains(tk.Literal, "_") {
+			d.Hint("_ only goes between two digits")
+		}
+		p.fail(d)
+	}
+	lit.Value = value
+	return lit
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken,Value: p.curTokenIs(token.TRUE)}
 }
@@ -395,6 +920,13 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Operator: p.curToken.Literal,
 		Left	: left,
 	}
+	// the keyword forms are spelled like the symbols in the tree
+	switch p.curToken.Type {
+	case token.AND:
+		expression.Operator = "&&"
+	case token.OR:
+		expression.Operator = "||"
+	}
 
 	precedence := p.curPrecedence()
 	p.nextToken()
@@ -402,6 +934,50 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	
 	return expression
 }
+// parseAssignExpression is right associative: a = b = c is a = (b = c)
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token	: p.curToken,
+		Operator: p.curToken.Literal,
+		Target	: target,
+	}
+	p.checkAssignTarget(target)
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+func (p *Parser) parsePrefixUpdateExpression() ast.Expression {
+	expression := &ast.UpdateExpression{
+		Token: p.curToken,
+		Operator: p.curToken.Literal,
+		Prefix: true,
+	}
+	p.nextToken()
+	expression.Target = p.parseExpression(PREFIX)
+	p.checkAssignTarget(expression.Target)
+
+	return expression
+}
+func (p *Parser) parsePostfixUpdateExpression(target ast.Expression) ast.Expression {
+	p.checkAssignTarget(target)
+	return &ast.UpdateExpression{
+		Token: p.curToken,
+		Operator: p.curToken.Literal,
+		Target: target,
+	}
+}
+
+// only variables and index expressions can be assigned to
+func (p *Parser) checkAssignTarget(target ast.Expression) {
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+		return
+	}
+	p.fail(diagnostic.New(CodeInvalidTarget, target.Pos(), target.End(), "cannot assign to %s", target.String()))
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token: p.curToken,
@@ -413,9 +989,11 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	defer func(nesting int) { p.nesting = nesting }(p.nesting)
+	p.nest()
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseError(p.curToken.Type)
+		p.noPrefixParseError(p.curToken)
 		return nil
 	}
 	leftExp := prefix()
@@ -425,17 +1003,52 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 			return leftExp
 		}
 		p.nextToken()
+		// the operator puts the left operand one level deeper
+		p.nest()
 		leftExp = infix(leftExp)
 	}
 	return leftExp
 }
 
-func (p *Parser) parseStatement() ast.Statement {
+// parseStatement returns nil when the statement is broken, the error is
+// recorded and the parser is left on the start of the next statement
+func (p *Parser) parseStatement() (stmt ast.Statement) {
+	level, loopDepth := p.braceLevel, p.loopDepth
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.loopDepth = loopDepth
+			p.synchronize(level)
+			stmt = nil
+		}
+	}()
+	return p.parseStatementKind()
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -454,11 +1067,25 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+		if stmt == nil {
+			// a stray } has no block to close at the top level
+			if p.curTokenIs(token.RBRACE) {
+				p.nextToken()
+			}
+			continue
 		}
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
+	// the lexer errors that did not stop a statement go in source order
+	for _,lexErr := range p.l.Diagnostics() {
+		if !slices.Contains(p.errors,lexErr) {
+			p.errors = append(p.errors,lexErr)
+		}
+	}
+	slices.SortStableFunc(p.errors,func(a,b *diagnostic.Diagnostic) int {
+		return a.Span.Start.Offset-b.Span.Start.Offset
+	})
 
 	return program
 }
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/assimad8/go-interpreter/internal/ast"
@@ -156,6 +157,97 @@ func TestIntegerLiteralExpression(t *testing.T){
 	}
 }
 
+func TestIntegerLiteralFormats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_dead_beef", 0xdeadbeef},
+		{"9223372036854775807", 9223372036854775807},
+		{"0", 0},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok || literal.Value != tt.expected {
+			t.Errorf("%s: wrong literal. expected=%d, got=%s", tt.input, tt.expected, stmt.Expression)
+		}
+	}
+}
+
+func TestInvalidNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+		hint  string
+	}{
+		{"9223372036854775808", CodeInvalidInteger, "integers are 64 bits, the largest literal is 9223372036854775807"},
+		{"0xffffffffffffffff", CodeInvalidInteger, "integers are 64 bits, the largest literal is 9223372036854775807"},
+		{"1__000", CodeInvalidInteger, "_ only goes between two digits"},
+		{"1_000_", CodeInvalidInteger, "_ only goes between two digits"},
+		{"0b102", CodeInvalidInteger, ""},
+		{"0x", CodeInvalidInteger, ""},
+		{"010", CodeInvalidInteger, "integers do not start with 0, octal ones start with 0o as in 0o17"},
+		{"08", CodeInvalidInteger, "integers do not start with 0, octal ones start with 0o as in 0o17"},
+		{"0_1", CodeInvalidInteger, "integers do not start with 0, octal ones start with 0o as in 0o17"},
+		{"1_.5", CodeInvalidFloat, "_ only goes between two digits"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) != 1 {
+			t.Errorf("%s: expected 1 error. got=%q", tt.input, p.Errors())
+			continue
+		}
+		hint := ""
+		if len(diags[0].Hints) != 0 {
+			hint = diags[0].Hints[0]
+		}
+		if diags[0].Code != tt.code || hint != tt.hint {
+			t.Errorf("%s: wrong error. expected=%s %q, got=%s %q", tt.input, tt.code, tt.hint, diags[0].Code, hint)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T){
+	tests := []struct{
+		input 		string
+		expected 	float64
+	}{
+		{"3.14;",3.14},
+		{"1e3;",1000},
+		{"2.5E-3;",0.0025},
+	}
+	for _,tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t,p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal,ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not ast.FloatLiteral. got=%T",stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g",tt.expected,literal.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpression(t *testing.T) {
 	prefixTests := []struct{
 		input 	     string
@@ -223,6 +315,12 @@ func TestParsingInfixExpression(t *testing.T) {
 		{"5 < 5",5,"<",5},
 		{"5 == 5",5,"==",5},
 		{"5 != 5",5,"!=",5},
+		{"5 >= 5",5,">=",5},
+		{"5 <= 5",5,"<=",5},
+		{"5 && 5",5,"&&",5},
+		{"5 || 5",5,"||",5},
+		{"5 and 5",5,"&&",5},
+		{"5 or 5",5,"||",5},
 	}
 
 	for _,tt := range infixTests {
@@ -282,6 +380,13 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"-(5 + 5)","(-(5 + 5))",},
 		{"a * [1, 2, 3, 4][b * c] * d","((a * ([1, 2, 3, 4][(b * c)])) * d)",},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])","add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",},
+		{"add(f(a), [g(b)], c)","add(f(a), [g(b)], c)",},
+		{"a >= b == c <= d","((a >= b) == (c <= d))"},
+		{"a || b && c","(a || (b && c))"},
+		{"a && b || c","((a && b) || c)"},
+		{"a == b && c != d","((a == b) && (c != d))"},
+		{"!a || b","((!a) || b)"},
+		{"x = a or b and c","(x = (a || (b && c)))"},
 	}
 
 	for _,tt := range tests {
@@ -460,6 +565,42 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		texts    []string
+		expected string
+	}{
+		{`"Hello ${name}!"`, []string{"Hello ", "!"}, "Hello ${name}!"},
+		{`"${a + b * 2}${len(xs)}"`, []string{"", "", ""}, "${(a + (b * 2))}${len(xs)}"},
+		{`"${ {"k": 1}["k"] } and ${"in ${x}"}"`, []string{"", " and ", ""}, "${({k:1}[k])} and ${in ${x}}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+		if len(str.Texts) != len(tt.texts) || len(str.Exprs) != len(tt.texts)-1 {
+			t.Errorf("%s: wrong number of parts. texts=%d, exprs=%d", tt.input, len(str.Texts), len(str.Exprs))
+			continue
+		}
+		for i, text := range tt.texts {
+			if str.Texts[i] != text {
+				t.Errorf("%s: wrong text %d. expected=%q, got=%q", tt.input, i, text, str.Texts[i])
+			}
+		}
+		if str.String() != tt.expected {
+			t.Errorf("%s: wrong String. expected=%q, got=%q", tt.input, tt.expected, str.String())
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T){
 	input := "[1,2*2,3+3]"
 
@@ -544,6 +685,22 @@ func TestParsingHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashLiteralKeepsKeyOrder(t *testing.T) {
+	input := `{"b":1,"a":2,3:3,"b":4}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t,p)
+
+	hash := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+	if len(hash.Keys) != 4 {
+		t.Fatalf("hash.Keys has wrong length. got=%d",len(hash.Keys))
+	}
+	if got := hash.String(); got != "{b:1, a:2, 3:3, b:4}" {
+		t.Errorf("wrong String. got=%s",got)
+	}
+}
+
 func TestEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -683,4 +840,406 @@ func checkParserErrors(t *testing.T,p *Parser) {
 		t.Errorf("parser error: %q",msg)
 	}
 	t.FailNow()
-}
\ No newline at end of file
+}
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =. got=INT"},
+		{"let x = 5;\nlet = 10;", "2:5: expected next token to be IDENT. got=="},
+		{"fn(x) {\n  ;\n}", "2:3: no prefix parse for ; found."},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q. got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, [2][0])"
+
+	l := lexer.NewFile("add.mk", input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Pos().String() != "add.mk:1:1" || let.End().String() != "add.mk:3:2" {
+		t.Errorf("let statement span wrong. got=%s-%s", let.Pos(), let.End())
+	}
+	body := let.Value.(*ast.FunctionLiteral).Body.Statements[0]
+	if body.Pos().String() != "add.mk:2:3" || body.End().String() != "add.mk:2:8" {
+		t.Errorf("body span wrong. got=%s-%s", body.Pos(), body.End())
+	}
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression
+	if call.Pos().String() != "add.mk:4:1" || call.End().String() != "add.mk:4:15" {
+		t.Errorf("call span wrong. got=%s-%s", call.Pos(), call.End())
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	input := "let x = 5 +;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	diags := p.Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic. got=%d (%v)", len(diags), p.Errors())
+	}
+	d := diags[0]
+	if d.Code != CodeNoPrefixParse {
+		t.Errorf("d.Code wrong. expected=%q, got=%q", CodeNoPrefixParse, d.Code)
+	}
+	if d.Span.Start.Column != 12 || d.Span.End.Column != 13 {
+		t.Errorf("d.Span wrong. got=%s-%s", d.Span.Start, d.Span.End)
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors int
+		expectedAST    string
+	}{
+		{"let x = add(1, 2;\nlet y = 3;\ny", 1, "let y = 3y"},
+		{"let f = fn(x) { x + };\nlet y = 2;", 1, "let f = fn(x)let y = 2"},
+		{"let h = {1: };\nlet y = 2;", 1, "let y = 2"},
+		{"if (x { let a = 1; }\nlet b = 2;", 1, "let b = 2"},
+		{"}\nlet c = 1;", 1, "let c = 1"},
+		{"let a = [1, 2\nlet b = 3;", 1, "let b = 3"},
+		{"let f = fn(x) { let = 1; x };\nf(2)", 1, "let f = fn(x)xf(2)"},
+		{"let = 1; let y 2; let z = 3;", 2, "let z = 3"},
+		{"return 5", 0, "return 5;"},
+		{"fn(x) { x", 1, ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("wrong number of errors for %q. expected=%d, got=%d (%v)", tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+		if program.String() != tt.expectedAST {
+			t.Errorf("wrong partial AST for %q. expected=%q, got=%q", tt.input, tt.expectedAST, program.String())
+		}
+	}
+}
+
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x }", "while(x < 10) x"},
+		{"for (x in [1, 2]) { x };", "for (x in [1, 2]) x"},
+		{"for (k, v in h) { k }", "for (k, v in h) k"},
+		{"for (let i = 0; i < 3; let i = i + 1) { i }", "for (let i = 0; (i < 3); let i = (i + 1)) i"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"while (true) { continue }", "whiletrue continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement for %q. got=%d", tt.input, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []string{
+		"break;",
+		"if (true) { continue; }",
+		"while (true) { fn() { break; } }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) != 1 || diags[0].Code != CodeOutsideLoop {
+			t.Errorf("expected one %s error for %q. got=%v", CodeOutsideLoop, input, p.Errors())
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 1 + 2", "(x = (y = (1 + 2)))"},
+		{"x += 2 * 3", "(x += (2 * 3))"},
+		{"x -= 1; x *= 2; x /= 3", "(x -= 1)(x *= 2)(x /= 3)"},
+		{"arr[i + 1] = v", "((arr[(i + 1)]) = v)"},
+		{`h["k"] = 1`, "((h[k]) = 1)"},
+		{"x++", "(x++)"},
+		{"--x", "(--x)"},
+		{"-x++", "(-(x++))"},
+		{"arr[0]++ + 1", "(((arr[0])++) + 1)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	tests := []string{"1 = 2", "f() += 1", "(a + b)++", "++5"}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) != 1 || diags[0].Code != CodeInvalidTarget {
+			t.Errorf("expected one %s error for %q. got=%v", CodeInvalidTarget, input, p.Errors())
+		}
+	}
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() };", "try f() finally g()"},
+		{"try { f() } catch (err) { throw err; } finally { g() }", "try f() catch (err) throw err; finally g()"},
+		{`throw "boom";`, "throw boom;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement for %q. got=%d", tt.input, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// the answer
+let x = /* inline */ 42; // done
+/* trailing */`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t,p)
+
+	if len(program.Statements) != 1 || program.String() != "let x = 42" {
+		t.Errorf("wrong program. got=%q",program.String())
+	}
+}
+
+// an unterminated comment is reported once, by the lexer
+func TestUnterminatedCommentError(t *testing.T) {
+	tests := []string{
+		"let x = 1; /* open",
+		"let x = /* open",
+		"f(1 /* open",
+		"if (x) { /* open",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) != 1 || diags[0].Code != lexer.CodeUnterminatedComment {
+			t.Errorf("%q: expected only the unterminated comment. got=%q",input,p.Errors())
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let s = "open`, []string{"1:9: string literal is not terminated"}},
+		{"f(`raw", []string{"1:3: string literal is not terminated"}},
+		// a bad escape does not stop the parser
+		{`let a = "\q"; let = 1; let b = "\u{zz}";`, []string{
+			"1:10: unknown escape sequence \\q",
+			"1:19: expected next token to be IDENT. got==",
+			"1:33: invalid Unicode escape",
+		}},
+		{`let s = "a ${}";`, []string{"1:14: missing expression in string interpolation"}},
+		{`let s = "a ${1 2}"; let = 1;`, []string{
+			"1:16: unexpected INT in string interpolation",
+			"1:25: expected next token to be IDENT. got==",
+		}},
+		{`let s = "a ${x +}";`, []string{"1:17: no prefix parse for OEF found."}},
+		{`let s = "a ${x`, []string{"1:9: string literal is not terminated"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%s: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("%s: wrong error %d. expected=%q, got=%q", tt.input, i, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestInvalidTryStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } g()", "1:13: expected catch or finally after the try block. got=IDENT"},
+		{"try { f() } catch { g() }", "1:19: expected next token to be (. got={"},
+		{"try { f() } catch (1) { g() }", "1:20: expected next token to be IDENT. got=INT"},
+		{"try f()", "1:5: expected next token to be {. got=IDENT"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+	}{
+		{strings.Repeat("- ", 1000) + "1", true},
+		{strings.Repeat("[", 1000) + strings.Repeat("]", 1000), true},
+		{strings.Repeat("- ", 100000) + "1", false},
+		{strings.Repeat("1 + ", MaxNesting) + "1", false},
+		{strings.Repeat("[", MaxNesting) + strings.Repeat("]", MaxNesting), true},
+		{strings.Repeat("[", MaxNesting+1) + strings.Repeat("]", MaxNesting+1), false},
+		{strings.Repeat("while (true) { ", MaxNesting+1) + strings.Repeat("}", MaxNesting+1), false},
+		{strings.Repeat(`"${`, MaxNesting) + "1" + strings.Repeat(`}"`, MaxNesting), false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if tt.valid {
+			checkParserErrors(t, p)
+		} else if len(diags) == 0 || diags[0].Code != CodeTooDeep {
+			t.Errorf("expected a %s error for %.20q... got=%d errors", CodeTooDeep, tt.input, len(diags))
+		}
+	}
+}
+
+func TestImportExportStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		name     string
+	}{
+		{`import "lib";`, `import "lib";`, "lib"},
+		{`import "path/to/strings.mk"`, `import "path/to/strings.mk";`, "strings"},
+		{`import "./größe"`, `import "./größe";`, "größe"},
+		{`import { a, b } from "./lib";`, `import { a, b } from "./lib";`, ""},
+		{`import { a, } from "lib"`, `import { a } from "lib";`, ""},
+		{`export let x = 5;`, "export let x = 5", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement for %q. got=%d", tt.input, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+		if is, ok := program.Statements[0].(*ast.ImportStatement); ok && is.Name != tt.name {
+			t.Errorf("wrong binding for %q. expected=%q, got=%q", tt.input, tt.name, is.Name)
+		}
+	}
+}
+
+func TestInvalidImportExport(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode string
+	}{
+		{`if (true) { import "lib"; }`, CodeNotTopLevel},
+		{`let f = fn() { export let x = 1; };`, CodeNotTopLevel},
+		{`import "my-lib";`, CodeInvalidImport},
+		{`import "lib2";`, CodeInvalidImport},
+		{`import {} from "lib";`, CodeInvalidImport},
+		{`import { a } "lib";`, CodeUnexpectedToken},
+		{`import lib;`, CodeUnexpectedToken},
+		{`export fn() {};`, CodeUnexpectedToken},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diags := p.Diagnostics()
+		if len(diags) == 0 || diags[0].Code != tt.expectedCode {
+			t.Errorf("expected a %s error for %q. got=%v", tt.expectedCode, tt.input, p.Errors())
+		}
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 
 	// "github.com/assimad8/go-interpreter/internal/token"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
 	"github.com/assimad8/go-interpreter/internal/evaluator"
 	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/module"
 	"github.com/assimad8/go-interpreter/internal/object"
 	"github.com/assimad8/go-interpreter/internal/parser"
 )
@@ -29,7 +31,9 @@ const MONKEY_FACE = `
 
 const PROMPT = ">> "
 
-func Start(in io.Reader,out io.Writer){
+// Start runs the REPL, imports are resolved from the working directory
+// and then with modules
+func Start(in io.Reader,out io.Writer,modules *module.Loader){
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
 
@@ -50,10 +54,18 @@ func Start(in io.Reader,out io.Writer){
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParserError(out,p.Errors())
+			printParserError(out,line,p.Diagnostics())
+			continue
+		}
+		evaluated := evaluator.New(evaluator.Options{Modules: modules}).Eval(program,env)
+		if errObj,ok := evaluated.(*object.Error); ok {
+			src := line
+			if moduleSrc,ok := modules.Source(errObj.Pos.File); ok {
+				src = moduleSrc
+			}
+			diagnostic.Render(out,src,errObj.Diagnostic())
 			continue
 		}
-		evaluated := evaluator.Eval(program,env)
 		if evaluated!=nil{
 			io.WriteString(out,evaluated.Inspect())
 			io.WriteString(out,"\n")
@@ -61,11 +73,9 @@ func Start(in io.Reader,out io.Writer){
 	}
 }
 
-func printParserError(out io.Writer,errors []string) {
+func printParserError(out io.Writer,src string,errors []*diagnostic.Diagnostic) {
 	io.WriteString(out,MONKEY_FACE)
 	io.WriteString(out,"Woops! We ran into some monkey busniss here!\n")
 	io.WriteString(out," parser errors:\n")
-	for _,msg := range errors {
-		io.WriteString(out,"\t"+msg+"\n")
-	}
+	diagnostic.RenderAll(out,src,errors)
 }
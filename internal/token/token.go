@@ -1,10 +1,61 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
-	Type TokenType 
+	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character of the token
+	End     Position // position right after the last character of the token
+
+	// the comments between the previous token and this one, only set
+	// when the lexer keeps them
+	Comments []Comment
+
+	Parts []Part // the pieces of an INTERPOLATED string
+}
+
+// Part is a piece of an interpolated string: text, then the tokens of the
+// expression of the ${} following it, which end with an EOF at the }.
+// The last part only has text.
+type Part struct {
+	Text   string
+	Tokens []Token
+}
+
+// Comment is a // or /* */ comment with its markers
+type Comment struct {
+	Text string
+	Pos  Position
+	End  Position
+}
+
+// Position is a location in the source, lines and columns start at 1
+type Position struct {
+	File   string // file name, empty when the source is not a file
+	Offset int    // byte offset, starting at 0
+	Line   int
+	Column int // counts chars, not bytes
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as file:line:col (or line:col without a file)
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.File != "" {
+			return p.File
+		}
+		return "-"
+	}
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -14,7 +65,9 @@ const (
 	//identifiers + literals
 	IDENT 	= "IDENT"
 	INT		= "INT"
+	FLOAT	= "FLOAT"
 	STRING	= "STRING"
+	INTERPOLATED = "INTERPOLATED" // a string with ${} in it
 
 	//Operators
 	ASSIGN 		= "="
@@ -32,9 +85,17 @@ const (
 	EQ		= "=="
 	NOT_EQ	= "!="
 
+	AND	= "&&"
+	OR	= "||"
+
 	PLUS_PLUS = "++"
 	MINUS_MINUS = "--"
 
+	PLUS_ASSIGN = "+="
+	MINUS_ASSIGN = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN = "/="
+
 	//Delimeters
 	COMMA		= ","
 	SEMICOLON	= ";"
@@ -55,6 +116,17 @@ const (
 	IF = "IF"
 	ELSE = "ELSE"
 	RETURN = "RETURN"
+	WHILE = "WHILE"
+	FOR = "FOR"
+	IN = "IN"
+	BREAK = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY = "TRY"
+	CATCH = "CATCH"
+	FINALLY = "FINALLY"
+	THROW = "THROW"
+	IMPORT = "IMPORT"
+	EXPORT = "EXPORT"
 )
 
 var keywords = map[string]TokenType {
@@ -65,6 +137,19 @@ var keywords = map[string]TokenType {
 	"false": FALSE,
 	"else": ELSE,
 	"return": RETURN,
+	"while": WHILE,
+	"for": FOR,
+	"in": IN,
+	"break": BREAK,
+	"continue": CONTINUE,
+	"try": TRY,
+	"catch": CATCH,
+	"finally": FINALLY,
+	"throw": THROW,
+	"import": IMPORT,
+	"export": EXPORT,
+	"and": AND,
+	"or": OR,
 }
 
 func LookupIden(ident string) TokenType {
@@ -0,0 +1,18 @@
+package vm
+
+import (
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// Frame is a running call, the locals of the function are the stack
+// slots starting at basePointer
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,21 @@
+package vm
+
+import "github.com/assimad8/go-interpreter/internal/object"
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// iterator is the state of a running for-in loop, it sits on the stack
+// below the values of the loop body
+type iterator struct {
+	keys    []object.Object
+	values  []object.Object
+	withKey bool
+	next    int
+}
+
+func (it *iterator) Type() object.ObjectType {
+	return ITERATOR_OBJ
+}
+func (it *iterator) Inspect() string {
+	return "iterator"
+}
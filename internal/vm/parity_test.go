@@ -0,0 +1,351 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// parityInputs are the inputs of the evaluator tests, plus cases for the
+// scoping rules the compiler has to reproduce
+var parityInputs = []string{
+	"5",
+	"10",
+	"-5",
+	"-10",
+	"5 +5 +5 +5-10",
+	"2 * 2 * 2 * 2 * 2",
+	"-50 + 100 - 50",
+	"5 * 2 + 10",
+	"5 + 2 * 10",
+	"20 + 2 * -10",
+	"50 / 2 * 2 + 10",
+	"2 * (5 + 10)",
+	"3 * 3 * 3 + 10",
+	"3 * (3 * 3) + 10",
+	"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+	"3.5",
+	"-2.5",
+	"1.5 + 1.5",
+	"1 + 0.5",
+	"0.5 * 4",
+	"7 / 2.0",
+	"1e2 - 1",
+	"let x = 1.5; x++; x",
+	"let x = 2; x *= 0.5; x",
+	"true",
+	"false",
+	"1 < 2",
+	"1 > 2",
+	"1 < 1",
+	"1 > 1",
+	"1 == 1",
+	"1 != 1",
+	"1 == 2",
+	"1 != 2",
+	"true == true",
+	"false == false",
+	"true == false",
+	"true != false",
+	"false != true",
+	"(1 < 2) == true",
+	"(1 < 2) == false",
+	"(1 > 2) == true",
+	"(1 > 2) == false",
+	"1 >= 1",
+	"1 >= 2",
+	"1 <= 1",
+	"2 <= 1",
+	"1 == 1.0",
+	"0.5 < 1",
+	"2.5 >= 2.5",
+	"[1, 2.5] == [1.0, 2.5]",
+	`"abc" == "abc"`,
+	`"abc" != "abd"`,
+	`"abc" < "abd"`,
+	`"b" > "abc"`,
+	`"ab" <= "ab"`,
+	`"" >= "a"`,
+	`1 == "1"`,
+	`"1" != 1`,
+	`[1] == ["a"]`,
+	`1 < "a"`,
+	`[1] < ["a"]`,
+	"[1, 2] == [1, 2]",
+	"[1, [2]] == [1, [3]]",
+	"[1, 2] != [1]",
+	"[1, 2] < [1, 3]",
+	"[1, 2] < [1, 2, 0]",
+	`["b"] >= ["a", "z"]`,
+	`{"a": [1]} == {"a": [1]}`,
+	"1 == true",
+	"true && true",
+	"true && false",
+	"false || true",
+	"false or false",
+	"1 < 2 and 2 < 3",
+	"!(1 > 2 || 2 > 3)",
+	"!false",
+	"!true",
+	"!!true",
+	"!!false",
+	"!5",
+	"!!5",
+	"if (true)  {10}",
+	"if (false) {10}",
+	"if (1) {10}",
+	"if (1<2) {10}",
+	"if (1>2) {10}",
+	"if (1<2) {10} else { 20}",
+	"if (1>2) {10} else { 20}",
+	"return 10;",
+	"return 10;9;",
+	"return 2*5;9;",
+	"9;return 2*5;9;",
+	"if (10>1){if(10>1){return 10;} return 1;};",
+	"5 + true;",
+	"5 + true; 5;",
+	"-true;",
+	"true + false;",
+	"5;true + false;5",
+	"if (10>1) { true + false; }",
+	"if (10>1) { if (10>1) {true + false;} return 1; }",
+	`"Hello" - "World"`,
+	"foobar;",
+	`{"name":"emad"}[fn(x){x}];`,
+	"let a = 5;a;",
+	"let a = 5*5;let b = a;b;",
+	"let a = 5*5;let b = a;let c = a + b;c;",
+	"let identity = fn(x) { x; }; identity(5);",
+	"let identity = fn(x) { return x; }; identity(5);",
+	"let double = fn(x) { return x * 2; }; double(5);",
+	"let add = fn(x, y) { x + y; }; add(5, 5);",
+	"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+	"fn(x) { x; }(5)",
+	`
+		let newAdder = fn(x) { fn(y) { x + y } };
+		let addTwo = newAdder(2);
+		addTwo(3);`,
+	`
+		let base = 10;
+		let addBase = fn(x) { x + base };
+		addBase(5);`,
+	`
+		let curry = fn(a) { fn(b) { fn(c) { a * 100 + b * 10 + c } } };
+		curry(1)(2)(3);`,
+	`
+		let x = 1;
+		let shadow = fn(x) { let inner = fn() { x }; inner() };
+		shadow(2) * 10 + x;`,
+	`
+		let x = 1;
+		let f = fn() { let x = 5; x };
+		f() + x;`,
+	`
+		let makeCounter = fn(start) { fn(step) { start + step } };
+		let a = makeCounter(10);
+		let b = makeCounter(20);
+		a(1) + b(2);`,
+	`
+		let apply = fn(f, x) { f(x) };
+		let twice = fn(f) { fn(x) { f(f(x)) } };
+		apply(twice(fn(x) { x * 3 }), 2);`,
+	`
+		let fact = fn(n) { if (n < 2) { return 1; } n * fact(n - 1) };
+		fact(5);`,
+	`
+		let outer = fn() {
+			let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+			fib(10)
+		};
+		outer();`,
+	`
+		let early = fn(x) { if (x > 0) { return x * 2; } return 0; };
+		early(3) + early(-1);`,
+	"let i = 0; while (i < 100000) { let i = i + 1; }; i",
+	"let i = 0; while (i < 10) { let i = i + 1; if (i == 5) { break; } }; i",
+	"let i = 0; let n = 0; while (i < 10) { let i = i + 1; if (i > 3) { continue; } let n = n + 1; }; n",
+	"while (false) { 1 }",
+	"let find = fn(arr) { for (x in arr) { if (x > 2) { return x; } } }; find([1, 2, 3, 4])",
+	"let find = fn(arr) { for (x in arr) { if (x > 9) { return x; } } }; find([1, 2])",
+	"let at = fn(arr) { for (i, x in arr) { if (x == 30) { return i; } } }; at([10, 20, 30])",
+	`let get = fn(h) { for (k, v in h) { if (k == 2) { return v; } } }; get({1: "a", 2: 20})`,
+	`let key = fn(h) { for (k in h) { return k; } }; key({7: "x"})`,
+	`let third = fn(s) { for (i, c in s) { if (i == 2) { return c; } } }; third("hello")`,
+	"let f = fn() { for (let i = 0; i < 10; let i = i + 1) { if (i == 4) { return i * 10; } } }; f()",
+	"let f = fn() { for (let i = 0; ; let i = i + 1) { if (i < 3) { continue; } return i; } }; f()",
+	"let f = fn() { for (x in [1, 2]) { for (y in [3, 4]) { if (y == 3) { continue; } return x * y; } } }; f()",
+	"let f = fn() { for (x in [5, 6]) { for (y in [3, 4]) { break; } return x; } }; f()",
+	"let i = 100; for (i in [1, 2]) { }; i",
+	"for (x in 5) { }",
+	"while (1 + true) { }",
+	"for (x in [1]) { x + true }",
+	"let x = 1; x = 5; x",
+	"let x = 1; x = x + 1",
+	"let x = 1; let y = 2; x = y = 7; x + y",
+	"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x",
+	"let x = 1; let f = fn() { x = 2 }; f(); x",
+	"let x = 1; let f = fn() { let x = 5; x = 6; x }; f() * 10 + x",
+	"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()",
+	"let sum = 0; for (x in [1, 2, 3]) { sum += x; }; sum",
+	"let n = 0; for (let i = 0; i < 10; i++) { n += i; }; n",
+	"let i = 0; while (i < 5) { i++; }; i",
+	"let arr = [1, 2, 3]; arr[1] = 20; arr[1] + arr[2]",
+	"let arr = [1, 2, 3]; arr[0] += 9; arr[0]",
+	`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`,
+	`let h = {"a": 1}; h["a"] *= 5; h["a"]`,
+	"let x = 5; x++",
+	"let x = 5; x++; x",
+	"let x = 5; ++x",
+	"let x = 5; x--; --x",
+	"let arr = [1]; arr[0]++; arr[0]",
+	"let arr = [1, 2]; let i = 0; arr[i++] = 9; arr[0] * 10 + i",
+	"y = 1",
+	"y += 1",
+	"let f = fn() { let z = 1; }; f(); z = 2",
+	"let arr = [1]; arr[3] = 1",
+	`let arr = [1]; arr["a"] = 1`,
+	`let s = "abc"; s[0] = "x"`,
+	`let h = {}; h[fn(){}] = 1`,
+	"let x = true; x += 1",
+	`let s = "a"; s++`,
+	`0 || "x"`,
+	`false || "x"`,
+	`1 && "x"`,
+	`false && "x"`,
+	`let name = if (false) { "n" }; name || "anonymous"`,
+	"let n = 0; let f = fn() { n += 1; true }; false && f(); n",
+	"let n = 0; let f = fn() { n += 1; true }; true || f(); n",
+	"let n = 0; let f = fn() { n += 1; true }; true and f() and f(); n",
+	"false && undefined",
+	"[1] < [true]",
+	`"a" < 1`,
+	"true >= false",
+	"1 <= true",
+	`"a" * -1`,
+	`len("")`,
+	`len("four")`,
+	`len(1)`,
+	`len("one","two")`,
+	`[rest([1, 2, 3]), rest([])]`,
+	"[1,2,3][0]",
+	"[1,2,3][1]",
+	"[1,2,3][2]",
+	"let i = 0;[1,2,3][i];",
+	"[1,2,3][1+1]",
+	"let myArray = [1,2,3];myArray[0]",
+	"let myArray = [1,2,3];myArray[0]+myArray[1]",
+	"[1,2,3][3]",
+	"[1,2,3][-1]",
+	`{"name":1}["name"]`,
+	`{"name":1}["no"]`,
+	`let key = "name";{"name":1}[key]`,
+	`{}["no"]`,
+	`{5:5}[5]`,
+	`{1:"a"}[1.0]`,
+	`let h = {2.0:1}; h[2] += 1; h`,
+	`{true:5}[true]`,
+	`{false:5}[false]`,
+	"let x = 1;\nlet y = x + z;",
+	"if (true) {\n  5 + true;\n}",
+	"let f = fn(x) { len(x) };\nf(1)",
+	`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+	"[1, 1 * 1, 2 + 2]",
+	`"hello" + " " + "world"`,
+	`"Hello World!"`,
+	"let f = fn() { let fs = []; for (x in [1, 2, 3]) { let fs = push(fs, fn() { x }); }; fs }; let fs = f(); fs[0]() + fs[2]()",
+	"let f = fn() { let g = fn() { h() }; let h = fn() { 7 }; g() }; f()",
+	"let f = fn(n) { if (n == 0) { return 0; } 1 + f(n - 1) }; f(500)",
+	"let y = 1; let f = fn() { y += 1; y }; f() + f() + y",
+	"let f = fn() { x }; let x = 3; f()",
+	"if (true) { let z = 4; }; z",
+	"let f = fn() { if (false) { let q = 1; }; q }; f()",
+	"len = 3",
+	"let f = fn(x) { let g = fn() { x = x * 2 }; g(); g(); x }; f(3)",
+	"fn(a, b) { a }(1)",
+	"5(1)",
+	"let f = fn() { 1 / 0.0 }; f() > 1000",
+	`let h = {"a": [1, 2]}; h["a"][1] += 5; h["a"]`,
+	"puts",
+	"let i = 0; while (i < 3) { i++ }",
+	`let r = 0; try { let r = 1; } catch (e) { r = 2; }; r`,
+	`let m = ""; try { 1 + true } catch (e) { m = e["message"]; }; m`,
+	`let m = ""; try { len(1) } catch (e) { m = e["type"] + ": " + e["message"]; }; m`,
+	`let v = 0; try { throw 42; } catch (e) { v = e["value"]; }; v`,
+	`let f = fn() { throw "deep"; }; let s = []; try { f() } catch (e) { s = e["trace"]; }; s`,
+	`let m = ""; try { throw 1; } catch (e) { m = e["stak"]; }; m`,
+	`let log = []; try { log = push(log, 1); } finally { log = push(log, 2); }; log`,
+	`let log = []; try { throw 1; } catch (e) { log = push(log, e["value"]); } finally { log = push(log, 2); }; log`,
+	`let f = fn() { try { return 1; } finally { return 2; } }; f()`,
+	`let f = fn() { try { throw 1; } finally { return 3; } }; f()`,
+	`let f = fn() { try { return 1; } finally { 2 } }; f()`,
+	`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n += x; } }; n`,
+	`let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue; } n += 10; } finally { n += x; } }; n`,
+	`let n = 0; while (n < 5) { try { n += 1; throw n; } catch (e) { if (e["value"] > 2) { break; } } }; n`,
+	`let inner = ""; try { try { throw "a"; } catch (e) { throw e; } } catch (e) { inner = e["message"]; }; inner`,
+	`let f = fn(x) { try { if (x) { throw "x"; } 1 } catch (e) { 2 } }; [f(true), f(false)]`,
+	`let f = fn() { 1 + true }; let g = fn() { try { f() } finally { 0 } }; g()`,
+	`let f = fn() { 1 + true }; try { f() } catch (e) { throw e; }`,
+	`try { 1 } catch (e) { 2 } finally { throw "late"; }`,
+	`throw [1, 2];`,
+	`let r = 0; try { try { throw 1; } finally { r += 1; } } catch (e) { r += e["value"] * 10; }; r`,
+	`let r = ""; try { [1, 2, missing()] } catch (e) { r = e["message"]; }; r`,
+	`split("a,b", ",")`,
+	`join(split("héllo", ""), "|")`,
+	`[upper("é"), lower("É"), trim("  x "), substr("héllo", 1, 2), index_of("héllo", "o")]`,
+	`format("%s=%05.1f %v", "pi", 3.14159, {"a": 1})`,
+	`format("%d", true)`,
+	`replace("aaa", "a", "bb", 2)`,
+	`map([1, 2, 3], fn(x) { x * x })`,
+	`let k = 10; map(range(3), fn(x) { x + k })`,
+	`let add = fn(a) { fn(b) { a + b } }; map([1, 2], add(5))`,
+	`map(["a"], upper)`,
+	`filter(range(10), fn(x) { x / 2 * 2 == x })`,
+	`reduce(range(5), fn(acc, x) { acc + x }, 100)`,
+	`let log = []; each([1, 2], fn(x) { log = push(log, x * 10) }); log`,
+	`[find([1, 2, 3], fn(x) { x > 1 }), any([1], fn(x) { x > 1 }), all([2], fn(x) { x > 1 })]`,
+	`sort([5, 3, 9], fn(a, b) { b - a })`,
+	`sort(["b", "a"])`,
+	`map([[1, 2], [3]], fn(xs) { map(xs, fn(x) { x * 2 }) })`,
+	`[reverse([1, 2]), zip([1], [2]), flatten([[1], [[2]]]), unique([1, 1, 2]), unique([1, 1.0, 2.0, 2])]`,
+	`map([1, 2], fn(x) { x + true })`,
+	`map([1], fn(x) { return x + 1; 99 })`,
+	`let r = ""; try { map([1], fn(x) { throw "inner"; }) } catch (e) { r = e["message"]; }; r`,
+	`map([1, 2], fn(x) { try { if (x == 2) { throw x; } x } catch (e) { -1 } })`,
+	`let f = fn() { map([1], fn(x) { x + true }) }; let g = fn() { try { f() } finally { 0 } }; g()`,
+	`sort([1, 2], fn(a, b) { a + true })`,
+	`{"b": 1, "a": 2, 3: 3}`,
+	`let h = {"b": 1}; h["a"] = 2; h["b"] = 3; [keys(h), values(h), items(h)]`,
+	`let ks = []; for (k, v in {"z": 1, "y": 2}) { ks = push(ks, k + v) }; ks`,
+	`let h = {"a": 1, "b": 2}; [delete(h, "a"), has(h, "a"), merge(h, {"c": 3})]`,
+	`map([1, 2, 3], fn(x) { if (x == 2) { map([true], fn(y) { y + 1 }) } else { x } })`,
+	`let user = {"name": "Ada"}; "Hello ${user["name"]}, you have ${len([1, 2])} items"`,
+	`let f = fn(n) { "${n}/${n * 2.5}/${[n]}/${"in ${n}"}" }; map([1, 2], f)`,
+	`"${puts}${null}"`,
+	`let x = 1; "a ${x + true} b"`,
+	`let größe = "héllo 😀"; [len(größe), größe[1], größe[6], größe[7], len(bytes(größe))]`,
+	`let out = []; for (i, c in "aé😀") { out = push(out, [i, c]) }; out`,
+	`let 名前 = "東京"; 名前 + true`,
+	`[0xff, 0o17, 0b1010, 1_000_000, 1_000.5]`,
+	`let f = fn(x) { 10 / x }; f(0)`,
+	`let r = ""; try { 1 / 0 } catch (e) { r = e["message"]; }; r`,
+	`let x = 9223372036854775807; x += 1`,
+	`let n = 1; for (i in range(70)) { n *= 2 }; n`,
+	`-(-9223372036854775807 - 1)`,
+	`let a = [1]; a[0] = a; let b = [1]; b[0] = b; [a == b, a <= b, a]`,
+}
+
+// TestParity runs every input through both engines, the results and the
+// errors with their positions must be the same
+func TestParity(t *testing.T) {
+	for _, input := range parityInputs {
+		program := parse(t, input)
+		expected := evaluator.Eval(program, object.NewEnvironment())
+		got := runVM(t, input)
+
+		if !sameResult(expected, got) {
+			t.Errorf("engines disagree on %q.\neval=%s\nvm=  %s", input, inspect(expected), inspect(got))
+		}
+	}
+}
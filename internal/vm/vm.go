@@ -0,0 +1,646 @@
+// Package vm executes the bytecode of the compiler. Operators, indexing
+// and builtins go through the evaluator's functions so both engines give
+// the same results.
+package vm
+
+import (
+	"slices"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/code"
+	"github.com/assimad8/go-interpreter/internal/compiler"
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/module"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+const (
+	StackSize   = 1 << 16
+	GlobalsSize = 1 << 16
+	MaxFrames   = 1 << 13
+)
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+}
+
+var updateOperators = map[code.Opcode]string{
+	code.OpAdd: "++",
+	code.OpSub: "--",
+}
+
+// handler is where an error raised inside a try continues, in the frame
+// of the try with the stack as it was when the try started
+type handler struct {
+	frame int
+	ip    int
+	sp    int
+}
+
+type VM struct {
+	globals *object.Globals // the ones of the main function
+
+	stack []object.Object
+	sp    int // the top of the stack is stack[sp-1]
+
+	frames   []Frame
+	handlers []handler // the tries running, innermost last
+
+	eval    *evaluator.Evaluator // runs the operators and builtins
+	modules *module.Loader
+
+	// a module runs on its own vm, its errors continue the stack of the
+	// importing one
+	parent      *VM
+	moduleFrame diagnostic.StackFrame
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobals runs bytecode against the globals of an earlier run,
+// a global is nil until it is defined
+func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	g := &object.Globals{Constants: bytecode.Constants, Values: globals, Names: bytecode.Globals}
+	main := &object.Closure{Fn: bytecode.Main, Globals: g}
+	frames := make([]Frame, 1, 64)
+	frames[0] = Frame{cl: main}
+
+	return &VM{
+		globals: g,
+		stack:   make([]object.Object, 1024),
+		frames:  frames,
+		eval:    evaluator.New(evaluator.Options{}),
+		modules: module.NewLoader(nil),
+	}
+}
+
+// SetModules makes the vm load imports with l, whose cache may be
+// shared with other runs
+func (vm *VM) SetModules(l *module.Loader) {
+	vm.modules = l
+}
+
+// Run executes the program and returns the value of its last statement,
+// or the *object.Error that stopped it
+func (vm *VM) Run() object.Object {
+	return vm.run(0)
+}
+
+// run executes until the frame at index base returns. Only the handlers
+// of that frame and the ones above it catch errors, the error goes to
+// the caller otherwise.
+func (vm *VM) run(base int) object.Object {
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+		g := frame.cl.Globals
+		ins := frame.Instructions()
+		start := frame.ip
+		op := code.Opcode(ins[start])
+		frame.ip++
+
+		var err *object.Error
+		switch op {
+		case code.OpConstant:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			err = vm.push(g.Constants[idx])
+		case code.OpPop:
+			vm.sp--
+			vm.stack[vm.sp] = nil
+		case code.OpDup:
+			err = vm.push(vm.stack[vm.sp-1])
+		case code.OpTrue:
+			err = vm.push(evaluator.TRUE)
+		case code.OpFalse:
+			err = vm.push(evaluator.FALSE)
+		case code.OpNull:
+			err = vm.push(evaluator.NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.eval.EvalInfix(operators[op], left, right))
+		case code.OpMinus:
+			err = vm.pushResult(evaluator.EvalPrefix("-", vm.pop()))
+		case code.OpBang:
+			err = vm.pushResult(evaluator.EvalPrefix("!", vm.pop()))
+		case code.OpUpdate:
+			operator := code.Opcode(ins[frame.ip])
+			frame.ip++
+			err = vm.pushResult(vm.eval.EvalUpdate(updateOperators[operator], vm.pop()))
+
+		case code.OpJump:
+			frame.ip = int(code.ReadUint16(ins[frame.ip:]))
+		case code.OpJumpNotTruthy:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if !evaluator.IsTruthy(vm.pop()) {
+				frame.ip = target
+			}
+		case code.OpJumpIfFalseOrPop, code.OpJumpIfTrueOrPop:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			if evaluator.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpIfTrueOrPop) {
+				frame.ip = target
+			} else {
+				vm.pop()
+			}
+
+		case code.OpGetGlobal:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			if g.Values[idx] == nil {
+				err = vm.notFound(g.Names, int(idx))
+				break
+			}
+			err = vm.push(g.Values[idx])
+		case code.OpSetGlobal:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			g.Values[idx] = vm.pop()
+		case code.OpAssignGlobal:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			if g.Values[idx] == nil {
+				err = vm.notFound(g.Names, int(idx))
+				break
+			}
+			g.Values[idx] = vm.stack[vm.sp-1]
+
+		case code.OpGetLocal:
+			idx := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			value := vm.stack[frame.basePointer+idx]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if value == nil {
+				err = vm.notFound(frame.cl.Fn.LocalNames, idx)
+				break
+			}
+			err = vm.push(value)
+		case code.OpSetLocal:
+			idx := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			vm.setLocal(frame, idx, vm.pop())
+		case code.OpAssignLocal:
+			idx := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			current := vm.stack[frame.basePointer+idx]
+			if cell, ok := current.(*object.Cell); ok {
+				current = cell.Value
+			}
+			if current == nil {
+				err = vm.notFound(frame.cl.Fn.LocalNames, idx)
+				break
+			}
+			vm.setLocal(frame, idx, vm.stack[vm.sp-1])
+		case code.OpUnsetLocal:
+			idx := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			vm.stack[frame.basePointer+idx] = nil
+		case code.OpGetFree:
+			idx := int(ins[frame.ip])
+			frame.ip++
+			cell := frame.cl.Free[idx]
+			if cell.Value == nil {
+				err = vm.notFound(frame.cl.Fn.FreeNames, idx)
+				break
+			}
+			err = vm.push(cell.Value)
+		case code.OpAssignFree:
+			idx := int(ins[frame.ip])
+			frame.ip++
+			cell := frame.cl.Free[idx]
+			if cell.Value == nil {
+				err = vm.notFound(frame.cl.Fn.FreeNames, idx)
+				break
+			}
+			cell.Value = vm.stack[vm.sp-1]
+		case code.OpGetBuiltin:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			name := g.Constants[idx].(*object.String).Value
+			builtin, ok := evaluator.LookupBuiltin(name)
+			if !ok {
+				err = evaluator.NewError("identifier not found: %s", name)
+				break
+			}
+			err = vm.push(builtin)
+
+		case code.OpArray:
+			n := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			elements := make([]object.Object, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			err = vm.push(&object.Array{Elements: elements})
+		case code.OpHash:
+			n := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			hash, errObj := vm.buildHash(vm.sp-n, vm.sp)
+			vm.sp -= n
+			if errObj != nil {
+				err = errObj
+				break
+			}
+			err = vm.push(hash)
+		case code.OpInterpolate:
+			n := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			str := vm.eval.Interpolate(vm.stack[vm.sp-n : vm.sp])
+			vm.sp -= n
+			err = vm.pushResult(str)
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.EvalIndex(left, index))
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.eval.SetIndex(left, index, value))
+		case code.OpIndexCompound:
+			operator := code.Opcode(ins[frame.ip])
+			frame.ip++
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.indexCompound(left, index, operators[operator], value))
+		case code.OpIndexUpdate:
+			operator := code.Opcode(ins[frame.ip])
+			postfix := ins[frame.ip+1] == 1
+			frame.ip += 2
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(vm.indexUpdate(left, index, updateOperators[operator], postfix))
+
+		case code.OpCellLocal:
+			idx := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			slot := &vm.stack[frame.basePointer+idx]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			err = vm.push(cell)
+		case code.OpCellFree:
+			idx := int(ins[frame.ip])
+			frame.ip++
+			err = vm.push(frame.cl.Free[idx])
+		case code.OpClosure:
+			idx := code.ReadUint16(ins[frame.ip:])
+			numFree := int(ins[frame.ip+2])
+			frame.ip += 3
+			free := make([]*object.Cell, numFree)
+			for i := range free {
+				free[i] = vm.stack[vm.sp-numFree+i].(*object.Cell)
+			}
+			vm.sp -= numFree
+			fn := g.Constants[idx].(*object.CompiledFunction)
+			err = vm.push(&object.Closure{Fn: fn, Free: free, Globals: g})
+		case code.OpCall:
+			numArgs := int(ins[frame.ip])
+			frame.ip++
+			err = vm.call(numArgs)
+		case code.OpReturnValue:
+			result := vm.pop()
+			if len(vm.frames) == 1 {
+				return result
+			}
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.dropHandlers()
+			// drop the locals and the function itself
+			clear(vm.stack[frame.basePointer-1 : vm.sp])
+			vm.sp = frame.basePointer - 1
+			if len(vm.frames) == base {
+				return result
+			}
+			err = vm.push(result)
+
+		case code.OpIterInit:
+			withKey := ins[frame.ip] == 1
+			frame.ip++
+			keys, values, errObj := vm.eval.ForInValues(vm.pop(), withKey)
+			if errObj != nil {
+				err = errObj
+				break
+			}
+			err = vm.push(&iterator{keys: keys, values: values, withKey: withKey})
+		case code.OpIterNext:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			it := vm.stack[vm.sp-1].(*iterator)
+			if it.next >= len(it.values) {
+				frame.ip = target
+				break
+			}
+			err = vm.push(it.values[it.next])
+			if err == nil && it.withKey {
+				err = vm.push(it.keys[it.next])
+			}
+			it.next++
+
+		case code.OpTry:
+			target := int(code.ReadUint16(ins[frame.ip:]))
+			frame.ip += 2
+			vm.handlers = append(vm.handlers, handler{frame: len(vm.frames) - 1, ip: target, sp: vm.sp})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			err = evaluator.Throw(vm.pop())
+		case code.OpImport:
+			idx := code.ReadUint16(ins[frame.ip:])
+			frame.ip += 2
+			path := g.Constants[idx].(*object.String).Value
+			pos, end := frame.cl.Fn.PosAt(start)
+			mod, errObj := vm.modules.Load(pos.File, path, func(mod *object.Module, program *ast.Program) *object.Error {
+				return vm.runModule(mod, program, module.Frame(mod, diagnostic.Span{Start: pos, End: end}))
+			})
+			if errObj != nil {
+				err = errObj
+				break
+			}
+			err = vm.push(mod)
+		}
+
+		if err != nil {
+			// the position is the one of the node the failing
+			// instruction was compiled from
+			if !err.Pos.IsValid() {
+				err.Pos, err.End = frame.cl.Fn.PosAt(start)
+				err.Stack = vm.callStack()
+			}
+			if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frame < base || !err.Catchable() {
+				return err
+			}
+			err = vm.catch(err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// callStack lists the calls of the running frames innermost first, the call
+// of a frame is the instruction its caller stopped at
+func (vm *VM) callStack() []diagnostic.StackFrame {
+	var stack []diagnostic.StackFrame
+	for i := len(vm.frames) - 1; i > 0; i-- {
+		caller := vm.frames[i-1]
+		frame := diagnostic.StackFrame{Function: vm.frames[i].cl.Fn.Name}
+		if frame.Function == "" {
+			frame.Function = "<anonymous>"
+		}
+		frame.Call.Start, frame.Call.End = caller.cl.Fn.PosAt(caller.ip - 1)
+		stack = append(stack, frame)
+	}
+	if vm.parent != nil {
+		stack = append(stack, vm.moduleFrame)
+		stack = append(stack, vm.parent.callStack()...)
+	}
+	return stack
+}
+
+// runModule compiles and runs a module on a vm of its own that shares
+// the evaluator and the loader, then reads the exported globals
+func (vm *VM) runModule(mod *object.Module, program *ast.Program, frame diagnostic.StackFrame) *object.Error {
+	c := compiler.New()
+	if err := c.Compile(program); err != nil {
+		if d, ok := err.(*diagnostic.Diagnostic); ok {
+			return module.Error(d)
+		}
+		return evaluator.NewError("%s", err)
+	}
+	bytecode := c.Bytecode()
+
+	child := NewWithGlobals(bytecode, make([]object.Object, len(bytecode.Globals)))
+	child.eval, child.modules = vm.eval, vm.modules
+	child.parent, child.moduleFrame = vm, frame
+	if errObj, ok := child.Run().(*object.Error); ok {
+		return errObj
+	}
+	for _, name := range module.Exports(program) {
+		mod.Exports[name] = child.globals.Values[slices.Index(bytecode.Globals, name)]
+	}
+	return nil
+}
+
+// catch unwinds to the innermost handler and pushes the exception for
+// its catch block
+func (vm *VM) catch(err *object.Error) *object.Error {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+	clear(vm.stack[h.sp:vm.sp])
+	vm.sp = h.sp
+	vm.frames[h.frame].ip = h.ip
+	return vm.push(&object.Exception{Err: err})
+}
+
+// dropHandlers removes the handlers of frames that returned, the
+// compiler pops them before a return so this is only a safeguard
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+func (vm *VM) call(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		fn := callee.Fn
+		if numArgs != fn.NumParameters {
+			return evaluator.NewError("wrong number of arguments. got=%d, want=%d", numArgs, fn.NumParameters)
+		}
+		if len(vm.frames) >= MaxFrames {
+			return stackOverflow()
+		}
+		basePointer := vm.sp - numArgs
+		if err := vm.grow(basePointer + fn.NumLocals); err != nil {
+			return err
+		}
+		// the slots may still hold values of an earlier call
+		clear(vm.stack[vm.sp : basePointer+fn.NumLocals])
+		vm.sp = basePointer + fn.NumLocals
+		vm.frames = append(vm.frames, Frame{cl: callee, basePointer: basePointer})
+		return nil
+	case *evaluator.Builtin, *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		var result object.Object
+		if builtin, ok := callee.(*evaluator.Builtin); ok {
+			result = vm.eval.CallBuiltin(builtin, args, vm.callFunction)
+		} else {
+			result = evaluator.CallHostBuiltin(callee.(*object.Builtin), args)
+		}
+		clear(vm.stack[vm.sp-1-numArgs : vm.sp])
+		vm.sp -= numArgs + 1
+		return vm.pushResult(result)
+	default:
+		return evaluator.NewError("not a function: %s", callee.Type())
+	}
+}
+
+// callFunction calls fn with args for a builtin and runs it to completion
+// before returning its result
+func (vm *VM) callFunction(fn object.Object, args []object.Object) object.Object {
+	sp, base := vm.sp, len(vm.frames)
+	if err := vm.grow(sp + 1 + len(args)); err != nil {
+		return err
+	}
+	vm.stack[sp] = fn
+	copy(vm.stack[sp+1:], args)
+	vm.sp = sp + 1 + len(args)
+	if err := vm.call(len(args)); err != nil {
+		vm.unwind(sp, base)
+		return err
+	}
+	if len(vm.frames) == base {
+		// a builtin, its result is already on the stack
+		return vm.pop()
+	}
+	result := vm.run(base)
+	if isError(result) {
+		vm.unwind(sp, base)
+	}
+	return result
+}
+
+// unwind drops the frames from base on and the stack from sp on, after
+// an error left a call
+func (vm *VM) unwind(sp, base int) {
+	vm.frames = vm.frames[:base]
+	vm.dropHandlers()
+	clear(vm.stack[sp:vm.sp])
+	vm.sp = sp
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hash := object.NewHash((endIndex - startIndex) / 2)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, evaluator.NewError("unusable as hash key: %s", key.Type())
+		}
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+	clear(vm.stack[startIndex:endIndex])
+	return hash, nil
+}
+
+// indexCompound evaluates left[index] op= value
+func (vm *VM) indexCompound(left, index object.Object, op string, value object.Object) object.Object {
+	current := evaluator.EvalIndex(left, index)
+	if isError(current) {
+		return current
+	}
+	updated := vm.eval.EvalInfix(op, current, value)
+	if isError(updated) {
+		return updated
+	}
+	return vm.eval.SetIndex(left, index, updated)
+}
+
+// indexUpdate evaluates ++ and -- on left[index], postfix gives the old
+// value
+func (vm *VM) indexUpdate(left, index object.Object, op string, postfix bool) object.Object {
+	current := evaluator.EvalIndex(left, index)
+	if isError(current) {
+		return current
+	}
+	updated := vm.eval.EvalUpdate(op, current)
+	if isError(updated) {
+		return updated
+	}
+	if result := vm.eval.SetIndex(left, index, updated); isError(result) {
+		return result
+	}
+	if postfix {
+		return current
+	}
+	return updated
+}
+
+// setLocal writes a local, through its cell when a closure captured it
+func (vm *VM) setLocal(frame *Frame, idx int, value object.Object) {
+	slot := &vm.stack[frame.basePointer+idx]
+	if cell, ok := (*slot).(*object.Cell); ok {
+		cell.Value = value
+		return
+	}
+	*slot = value
+}
+
+func (vm *VM) notFound(names []string, idx int) *object.Error {
+	return evaluator.NewError("identifier not found: %s", names[idx])
+}
+
+func (vm *VM) push(obj object.Object) *object.Error {
+	if err := vm.grow(vm.sp + 1); err != nil {
+		return err
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+	return nil
+}
+
+// pushResult pushes the result of an operation unless it failed
+func (vm *VM) pushResult(obj object.Object) *object.Error {
+	if errObj, ok := obj.(*object.Error); ok {
+		return errObj
+	}
+	return vm.push(obj)
+}
+
+func (vm *VM) pop() object.Object {
+	vm.sp--
+	obj := vm.stack[vm.sp]
+	vm.stack[vm.sp] = nil
+	return obj
+}
+
+// grow makes room for size stack slots
+func (vm *VM) grow(size int) *object.Error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if size > StackSize {
+		return stackOverflow()
+	}
+	stack := make([]object.Object, min(max(size, 2*len(vm.stack)), StackSize))
+	copy(stack, vm.stack)
+	vm.stack = stack
+	return nil
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+// stackOverflow has the call depth code of the evaluator's depth limit
+func stackOverflow() *object.Error {
+	err := evaluator.NewError("stack overflow")
+	err.Code = object.CodeCallDepth
+	return err
+}
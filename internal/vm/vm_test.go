@@ -0,0 +1,317 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/assimad8/go-interpreter/internal/ast"
+	"github.com/assimad8/go-interpreter/internal/compiler"
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+)
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1 + 2", 3},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, runVM(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosuresShareVariables(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let f = fn(x) { let inc = fn() { x++ }; inc(); inc(); x }; f(1)", 3},
+		{"let f = fn() { let a = fn() { b() }; let b = fn() { 2 }; a() }; f()", 2},
+		{"let f = fn() { let sum = fn(n) { if (n == 0) { return 0; } n + sum(n - 1) }; sum(4) }; f()", 10},
+		{"let f = fn(a) { fn(b) { fn(c) { a = a + b + c; a } } }; let g = f(1)(2); g(3); g(3)", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, runVM(t, tt.input), tt.expected)
+	}
+}
+
+// the values of the enclosing expressions are dropped when break or
+// continue leave an iteration
+func TestLoopJumpsInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; let n = 0; while (i < 5) { i++; n += if (i == 3) { continue; } else { 1 }; }; n", 4},
+		{"let n = 0; for (x in [1, 2, 3]) { n += 1 + if (x == 2) { break; } else { 0 }; }; n", 1},
+		{"let f = fn() { let n = 0; for (let i = 0; i < 4; i++) { n += [i, if (i == 1 || i == 3) { continue; }][0]; }; n }; f()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, runVM(t, tt.input), tt.expected)
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet y = x + z;", "ERROR: 2:13: identifier not found: z"},
+		{"if (true) {\n  5 + true;\n}", "ERROR: 2:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(x) { len(x) };\nf(1)", "ERROR: 1:17: argument to 'len' not supported. got INTEGER"},
+		{"let f = fn(x) { x };\nf(1, 2)", "ERROR: 2:1: wrong number of arguments. got=2, want=1"},
+		{"let f = fn() { f() }; f()", "ERROR: 1:16: stack overflow"},
+		{"let f = fn() { f() }; try { f() } catch (e) { 1 }", "ERROR: 1:16: stack overflow"},
+	}
+
+	for _, tt := range tests {
+		result := runVM(t, tt.input)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T(%+v)", tt.input, result, result)
+		}
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errObj.Inspect())
+		}
+	}
+}
+
+// the stack of an error names the same calls as in the evaluator
+func TestErrorStackParity(t *testing.T) {
+	inputs := []string{
+		"let inner = fn(x) { x + true };\nlet outer = fn() { inner(1) };\nouter()",
+		"let f = fn(n) { if (n == 0) { len(1) } else { f(n - 1) } };\nf(3)",
+		"let apply = fn(g) { g() };\napply(fn() { [][\"a\"] })",
+		"let f = fn(x) { x };\nlet g = fn() { f(1, 2) };\ng()",
+		"1 + true",
+		"let f = fn() { 1 + true };\nlet g = fn() { try { f() } catch (e) { throw e; } };\ng()",
+		"let f = fn() { throw \"x\"; };\ntry { f() } finally { 1 }",
+		"let f = fn(x) { x + true };\nmap([1], f)",
+		"let f = fn(x) { len(x) };\nlet g = fn(xs) { map(xs, f) };\ng([[1], 2])",
+		"sort([1, 2], fn(a, b) {\n  throw \"cmp\";\n})",
+	}
+
+	for _, input := range inputs {
+		expected, ok := evaluator.Eval(parse(t, input), object.NewEnvironment()).(*object.Error)
+		if !ok {
+			t.Fatalf("evaluator returned no error for %q", input)
+		}
+		got, ok := runVM(t, input).(*object.Error)
+		if !ok {
+			t.Fatalf("vm returned no error for %q", input)
+		}
+		if !reflect.DeepEqual(expected.Stack, got.Stack) {
+			t.Errorf("wrong stack for %q.\nwant=%+v\ngot=%+v", input, expected.Stack, got.Stack)
+		}
+	}
+}
+
+// modules run on a vm of their own, their functions keep using the
+// module's globals and constants when called from the importer
+func TestImportParity(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.mk":    "let scale = 3;\nlet hidden = fn(x) { x * scale };\nexport let triple = fn(x) { hidden(x) };\nexport let name = \"lib\";",
+		"shared.mk": `export let state = {"n": 0}; export let bump = fn() { state["n"] += 1; state["n"] };`,
+		"uses.mk":   `import { bump } from "shared"; export let twice = fn() { bump(); bump() };`,
+		"a.mk":      `import "b";`,
+		"b.mk":      `import "a";`,
+		"bad.mk":    "export let broken = fn() { 1 + true };",
+		"fails.mk":  "let f = fn() { throw \"at load\"; };\nf();",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := filepath.Join(dir, "main.mk")
+
+	inputs := []string{
+		`import "lib"; lib["triple"](4)`,
+		`import { triple, name } from "./lib"; name + triple(1)`,
+		`import { bump } from "shared"; import { twice } from "uses"; bump(); twice()`,
+		`import "lib"; lib["hidden"]`,
+		`import "missing";`,
+		`import "a";`,
+		`import { broken } from "bad"; let g = fn() { broken() }; g()`,
+		`import "fails";`,
+		`import { broken } from "bad"; let m = []; try { broken(); } catch (e) { m = e["trace"]; }; m`,
+	}
+
+	for _, input := range inputs {
+		p := parser.New(lexer.NewFile(main, input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", input, p.Errors())
+		}
+		expected := evaluator.Eval(program, object.NewEnvironment())
+
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			t.Fatalf("compiler error for %q: %s", input, err)
+		}
+		got := New(c.Bytecode()).Run()
+
+		if !sameResult(expected, got) {
+			t.Errorf("engines disagree on %q.\neval=%s\nvm=  %s", input, inspect(expected), inspect(got))
+		}
+		if expectedErr, ok := expected.(*object.Error); ok {
+			if gotErr := got.(*object.Error); !reflect.DeepEqual(expectedErr.Stack, gotErr.Stack) {
+				t.Errorf("wrong stack for %q.\nwant=%+v\ngot=%+v", input, expectedErr.Stack, gotErr.Stack)
+			}
+		}
+	}
+}
+
+func TestGlobalsAcrossRuns(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	globals := make([]object.Object, GlobalsSize)
+	var constants []object.Object
+
+	inputs := []string{"let a = 40;", "let add = fn(x) { a + x };", "add(2)"}
+	var result object.Object
+	for _, input := range inputs {
+		c := compiler.NewWithState(symbols, constants)
+		if err := c.Compile(parse(t, input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := c.Bytecode()
+		constants = bytecode.Constants
+		result = NewWithGlobals(bytecode, globals).Run()
+	}
+	testIntegerObject(t, result, 42)
+}
+
+func TestHostBuiltins(t *testing.T) {
+	symbols := compiler.NewSymbolTable()
+	globals := make([]object.Object, GlobalsSize)
+	nothing := symbols.Define("nothing")
+	globals[nothing.Index] = &object.Builtin{Fn: func(args ...object.Object) object.Object { return nil }}
+	explode := symbols.Define("explode")
+	globals[explode.Index] = &object.Builtin{Fn: func(args ...object.Object) object.Object { panic("boom") }}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = nothing(); [x, map([1], nothing)]", "[null, [null]]"},
+		{"explode()", "ERROR: 1:1: builtin function panicked: boom"},
+		{"let m = \"\"; try { explode() } catch (e) { m = e[\"message\"]; }; m", "builtin function panicked: boom"},
+	}
+	for _, tt := range tests {
+		c := compiler.NewWithState(symbols, nil)
+		if err := c.Compile(parse(t, tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+		if got := inspect(NewWithGlobals(c.Bytecode(), globals).Run()); got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	input := `
+	let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) };
+	fib(20);`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	b.Run("eval", func(b *testing.B) {
+		for b.Loop() {
+			evaluator.Eval(program, object.NewEnvironment())
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		c := compiler.New()
+		if err := c.Compile(program); err != nil {
+			b.Fatal(err)
+		}
+		bytecode := c.Bytecode()
+		for b.Loop() {
+			New(bytecode).Run()
+		}
+	})
+}
+
+// helper functions
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func runVM(t *testing.T, input string) object.Object {
+	t.Helper()
+	c := compiler.New()
+	if err := c.Compile(parse(t, input)); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+	return New(c.Bytecode()).Run()
+}
+
+// sameResult compares the results of the two engines. A statement has no
+// value in the evaluator and null in the vm, and functions only have to
+// be functions since the vm cannot print their source.
+func sameResult(expected, got object.Object) bool {
+	if expected == nil {
+		expected = evaluator.NULL
+	}
+	if expected.Type() != got.Type() {
+		return false
+	}
+	switch expected := expected.(type) {
+	case *object.Function:
+		return true
+	case *object.Hash:
+		pairs := got.(*object.Hash).Pairs
+		if len(pairs) != len(expected.Pairs) {
+			return false
+		}
+		for key, pair := range expected.Pairs {
+			other, ok := pairs[key]
+			if !ok || !sameResult(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return expected.Inspect() == got.Inspect()
+	}
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return obj.Inspect()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
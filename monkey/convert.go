@@ -0,0 +1,196 @@
+package monkey
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/object"
+)
+
+// ToObject converts a Go value to a language value. Supported are nil,
+// bool, integers, floats, strings, slices, arrays, maps with hashable keys,
+// BuiltinFunc and values that already are an Object. A slice, map or
+// pointer containing itself is an error.
+func ToObject(v any) (Object, error) {
+	return toObject(v, map[visit]bool{})
+}
+
+// visit is a slice, map or pointer being converted. Meeting it again
+// inside itself means the value contains itself and would never end.
+type visit struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// toObject converts v, visiting holds the values enclosing it
+func toObject(v any, visiting map[visit]bool) (Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case Object:
+		return v, nil
+	case bool:
+		if v {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case string:
+		return &object.String{Value: v}, nil
+	case BuiltinFunc:
+		return &object.Builtin{Fn: object.BuiltinFunction(v)}, nil
+	case func(args ...Object) Object:
+		return &object.Builtin{Fn: v}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if kind := rv.Kind(); (kind == reflect.Slice || kind == reflect.Map || kind == reflect.Pointer) && !rv.IsNil() {
+		key := visit{ptr: rv.Pointer(), typ: rv.Type()}
+		if kind == reflect.Slice {
+			key.len = rv.Len()
+		}
+		if visiting[key] {
+			return nil, fmt.Errorf("monkey: cannot convert %T that contains itself", v)
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("monkey: %d overflows INTEGER", rv.Uint())
+		}
+		return &object.Integer{Value: int64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: rv.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: rv.String()}, nil
+	case reflect.Bool:
+		return ToObject(rv.Bool())
+	case reflect.Slice, reflect.Array:
+		elements := make([]Object, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			el, err := toObject(rv.Index(i).Interface(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, el)
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make([]object.HashPair, 0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key().Interface(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := key.(object.Hashable); !ok {
+				return nil, fmt.Errorf("monkey: unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value().Interface(), visiting)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, object.HashPair{Key: key, Value: value})
+		}
+		// Go maps have no order, sorting the keys keeps the hash the same
+		// from one conversion to the next
+		slices.SortFunc(pairs, func(a, b object.HashPair) int { return compareKeys(a.Key, b.Key) })
+		hash := object.NewHash(len(pairs))
+		for _, pair := range pairs {
+			hash.Set(pair.Key.(object.Hashable).HashKey(), pair)
+		}
+		return hash, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toObject(rv.Elem().Interface(), visiting)
+	}
+	return nil, fmt.Errorf("monkey: cannot convert %T", v)
+}
+
+// compareKeys orders hash keys by type, then numbers by value, strings
+// bytewise and false before true
+func compareKeys(a, b Object) int {
+	if c := cmp.Compare(a.Type(), b.Type()); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case *object.Integer:
+		return cmp.Compare(a.Value, b.(*object.Integer).Value)
+	case *object.Float:
+		return cmp.Compare(a.Value, b.(*object.Float).Value)
+	case *object.String:
+		return cmp.Compare(a.Value, b.(*object.String).Value)
+	case *object.Boolean:
+		if a.Value == b.(*object.Boolean).Value {
+			return 0
+		}
+		if a.Value {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// MustObject is like ToObject but panics on unsupported values
+func MustObject(v any) Object {
+	obj, err := ToObject(v)
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+// FromObject converts a language value to a Go value: INTEGER to int64,
+// FLOAT to float64, STRING to string, BOOLEAN to bool, NULL to nil, ARRAY to []any and
+// HASH to map[any]any. Other values, like functions, are returned as is.
+func FromObject(obj Object) any {
+	return fromObject(obj, map[Object]any{})
+}
+
+// fromObject converts obj, done holds the arrays and hashes already
+// converted so a value shared or containing itself keeps its structure
+// instead of recursing forever
+func fromObject(obj Object, done map[Object]any) any {
+	if v, ok := done[obj]; ok {
+		return v
+	}
+	switch obj := obj.(type) {
+	case nil, *object.NULL:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Float:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.Array:
+		values := make([]any, len(obj.Elements))
+		done[obj] = values
+		for i, el := range obj.Elements {
+			values[i] = fromObject(el, done)
+		}
+		return values
+	case *object.Hash:
+		values := make(map[any]any, len(obj.Pairs))
+		done[obj] = values
+		for _, pair := range obj.Pairs {
+			values[fromObject(pair.Key, done)] = fromObject(pair.Value, done)
+		}
+		return values
+	default:
+		return obj
+	}
+}
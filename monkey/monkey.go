@@ -0,0 +1,188 @@
+// Package monkey embeds the interpreter in other Go programs.
+//
+//	in := monkey.New()
+//	in.RegisterBuiltin("double", func(args ...monkey.Object) monkey.Object {
+//		if len(args) != 1 {
+//			return monkey.NewError("wrong number of arguments. got=%d, want=1", len(args))
+//		}
+//		n, ok := monkey.FromObject(args[0]).(int64)
+//		if !ok {
+//			return monkey.NewError("argument to 'double' must be INTEGER")
+//		}
+//		return monkey.MustObject(n * 2)
+//	})
+//	in.Set("limit", 10)
+//	result, err := in.Eval(ctx, "double(limit)")
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/assimad8/go-interpreter/internal/diagnostic"
+	"github.com/assimad8/go-interpreter/internal/evaluator"
+	"github.com/assimad8/go-interpreter/internal/lexer"
+	"github.com/assimad8/go-interpreter/internal/module"
+	"github.com/assimad8/go-interpreter/internal/object"
+	"github.com/assimad8/go-interpreter/internal/parser"
+)
+
+// Object is a value of the language
+type Object = object.Object
+
+// Diagnostic describes a parse or runtime error with its source span
+type Diagnostic = diagnostic.Diagnostic
+
+// StackFrame is a call that was running when a runtime error was raised,
+// Diagnostic.Stack lists them innermost first
+type StackFrame = diagnostic.StackFrame
+
+// BuiltinFunc is a Go function callable from scripts, it reports
+// failures by returning NewError. A nil result is null and a panic
+// becomes a runtime error of the script.
+type BuiltinFunc func(args ...Object) Object
+
+// Interpreter holds the global environment shared by successive Eval
+// calls. It is not safe for concurrent use.
+type Interpreter struct {
+	env     *object.Environment
+	limits  Limits
+	modules *module.Loader // keeps the imported modules across Eval calls
+	output  io.Writer      // where puts writes, os.Stdout if nil
+}
+
+// Limits bound each Eval call, a script exceeding them fails with an
+// error instead of hanging or crashing the process. Whatever the limits,
+// source nested more than 10000 levels deep does not parse and a run
+// evaluating more than 200000 nested nodes at once fails.
+type Limits struct {
+	MaxDepth int   // nested function calls, 10000 when 0
+	MaxSteps int64 // evaluated nodes, unlimited when 0
+	// bytes of the strings, arrays and hashes created, unlimited when 0
+	MaxMemory int64
+}
+
+func New() *Interpreter {
+	return &Interpreter{env: object.NewEnvironment(), modules: module.NewLoader(nil)}
+}
+
+// Error is returned by Eval when the source does not parse or raises an
+// error at runtime
+type Error struct {
+	Source      string
+	Diagnostics []*Diagnostic
+	cause       error // the context error when evaluation was canceled
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the context error of a canceled evaluation, so it can
+// be checked with errors.Is
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Eval parses and evaluates src in the interpreter's global environment
+// and returns the value of the last statement. Evaluation stops with an
+// error once the context is done or a limit set with SetLimits is hit.
+func (in *Interpreter) Eval(ctx context.Context, src string) (Object, error) {
+	return in.EvalFile(ctx, "", src)
+}
+
+// EvalFile is like Eval, file is the name reported in error positions
+func (in *Interpreter) EvalFile(ctx context.Context, file, src string) (Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.NewFile(file, src))
+	program := p.ParseProgram()
+	if len(p.Diagnostics()) != 0 {
+		return nil, &Error{Source: src, Diagnostics: p.Diagnostics()}
+	}
+
+	ev := evaluator.New(evaluator.Options{
+		Context:   ctx,
+		MaxDepth:  in.limits.MaxDepth,
+		MaxSteps:  in.limits.MaxSteps,
+		MaxMemory: in.limits.MaxMemory,
+		Modules:   in.modules,
+		Stdout:    in.output,
+	})
+	evaluated := ev.Eval(program, in.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		// an error raised in an imported module points into its source
+		if moduleSrc, ok := in.modules.Source(errObj.Pos.File); ok {
+			src = moduleSrc
+		}
+		err := &Error{Source: src, Diagnostics: []*Diagnostic{errObj.Diagnostic()}}
+		if errObj.Code == object.CodeCanceled {
+			err.cause = ctx.Err()
+		}
+		return nil, err
+	}
+	if evaluated == nil {
+		return evaluator.NULL, nil
+	}
+	return evaluated, nil
+}
+
+// SetSearchPath sets the directories searched for imported modules
+// after the one of the importing file, or the working directory for
+// sources evaluated without a file name. A module is evaluated once and
+// shared by the following Eval calls.
+func (in *Interpreter) SetSearchPath(dirs ...string) {
+	in.modules.SearchPath = dirs
+}
+
+// SetLimits sets the limits of the following Eval calls
+func (in *Interpreter) SetLimits(limits Limits) {
+	in.limits = limits
+}
+
+// SetOutput makes puts write to w in the following Eval calls instead
+// of os.Stdout
+func (in *Interpreter) SetOutput(w io.Writer) {
+	in.output = w
+}
+
+// Set binds name to value in the global environment, value is converted
+// with ToObject
+func (in *Interpreter) Set(name string, value any) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Get returns the global bound to name
+func (in *Interpreter) Get(name string) (Object, bool) {
+	return in.env.Get(name)
+}
+
+// RegisterBuiltin makes fn callable from scripts as name, it shadows
+// the builtin functions of the language with the same name
+func (in *Interpreter) RegisterBuiltin(name string, fn BuiltinFunc) {
+	in.env.Set(name, &object.Builtin{Fn: object.BuiltinFunction(fn)})
+}
+
+// NewError creates the value a BuiltinFunc returns to fail
+func NewError(format string, a ...any) Object {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// IsError reports whether obj is an error value
+func IsError(obj Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
@@ -0,0 +1,288 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	in := New()
+	ctx := context.Background()
+
+	if _, err := in.Eval(ctx, "let base = 40;"); err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	result, err := in.Eval(ctx, "base + 2")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if FromObject(result) != int64(42) {
+		t.Errorf("wrong result. expected=42, got=%s", result.Inspect())
+	}
+
+	base, ok := in.Get("base")
+	if !ok || FromObject(base) != int64(40) {
+		t.Errorf("Get(base) wrong. got=%v, %t", base, ok)
+	}
+}
+
+func TestSetAndRegisterBuiltin(t *testing.T) {
+	in := New()
+	if err := in.Set("prices", map[string]any{"apple": 3, "pear": 5}); err != nil {
+		t.Fatalf("Set returned error: %s", err)
+	}
+	in.RegisterBuiltin("double", func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		n, ok := FromObject(args[0]).(int64)
+		if !ok {
+			return NewError("argument to 'double' must be INTEGER. got=%s", args[0].Type())
+		}
+		return MustObject(n * 2)
+	})
+
+	result, err := in.Eval(context.Background(), `double(prices["pear"])`)
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if FromObject(result) != int64(10) {
+		t.Errorf("wrong result. expected=10, got=%s", result.Inspect())
+	}
+
+	_, err = in.Eval(context.Background(), `double("x")`)
+	var evalErr *Error
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("expected *Error. got=%T (%v)", err, err)
+	}
+	if evalErr.Error() != "1:1: argument to 'double' must be INTEGER. got=STRING" {
+		t.Errorf("wrong error. got=%q", evalErr.Error())
+	}
+}
+
+func TestMisbehavingBuiltins(t *testing.T) {
+	in := New()
+	in.RegisterBuiltin("nothing", func(args ...Object) Object { return nil })
+	in.RegisterBuiltin("explode", func(args ...Object) Object { panic("boom") })
+
+	result, err := in.Eval(context.Background(), `let x = nothing(); [x, map([1], nothing)]`)
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if result.Inspect() != "[null, [null]]" {
+		t.Errorf("wrong result. expected=[null, [null]], got=%s", result.Inspect())
+	}
+
+	_, err = in.Eval(context.Background(), `explode()`)
+	if err == nil || err.Error() != "1:1: builtin function panicked: boom" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+	result, err = in.Eval(context.Background(), `let m = ""; try { explode() } catch (e) { m = e["message"]; }; m`)
+	if err != nil || FromObject(result) != "builtin function panicked: boom" {
+		t.Errorf("panic not catchable. got=%v, %v", result, err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	in := New()
+
+	_, err := in.Eval(context.Background(), "let = 1;")
+	var evalErr *Error
+	if !errors.As(err, &evalErr) || len(evalErr.Diagnostics) != 1 {
+		t.Fatalf("expected a parse error. got=%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := in.Eval(ctx, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled. got=%v", err)
+	}
+}
+
+func TestEvalErrorStack(t *testing.T) {
+	in := New()
+	_, err := in.EvalFile(context.Background(), "rules.mk", "let rule = fn(x) { x[0] };\nlet check = fn() { rule(1) + 1 };\ncheck()")
+	var evalErr *Error
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+
+	stack := evalErr.Diagnostics[0].Stack
+	expected := []string{"rule rules.mk:2:20", "check rules.mk:3:1"}
+	if len(stack) != len(expected) {
+		t.Fatalf("wrong stack. got=%+v", stack)
+	}
+	for i, frame := range stack {
+		if got := frame.Function + " " + frame.Call.Start.String(); got != expected[i] {
+			t.Errorf("wrong frame %d. expected=%q, got=%q", i, expected[i], got)
+		}
+	}
+}
+
+func TestEvalImports(t *testing.T) {
+	dir := t.TempDir()
+	src := "export let area = fn(w, h) { w * h };\nexport let check = fn(x) { x[0] };\n"
+	if err := os.WriteFile(filepath.Join(dir, "geometry.mk"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	in := New()
+	ctx := context.Background()
+	if _, err := in.Eval(ctx, `import "geometry";`); err == nil {
+		t.Fatalf("expected geometry not to be found without a search path")
+	}
+
+	in.SetSearchPath(dir)
+	if _, err := in.Eval(ctx, `import { area } from "geometry";`); err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	result, err := in.Eval(ctx, `import "geometry"; geometry["area"](3, 4) + area(1, 2)`)
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if got := FromObject(result); got != int64(14) {
+		t.Errorf("wrong result. expected=14, got=%v", got)
+	}
+
+	// the error is raised in the module and comes with its source
+	_, err = in.Eval(ctx, `import { check } from "geometry"; check(1)`)
+	var evalErr *Error
+	if !errors.As(err, &evalErr) || evalErr.Source != src {
+		t.Errorf("expected an error with the module source. got=%v", err)
+	}
+}
+
+func TestEvalLimits(t *testing.T) {
+	in := New()
+	in.SetLimits(Limits{MaxDepth: 50, MaxSteps: 100000, MaxMemory: 1 << 20})
+
+	tests := []struct {
+		input        string
+		expectedCode string
+	}{
+		{"let f = fn() { f() }; f()", "R002"},
+		{"while (true) { }", "R003"},
+		{`"a" * 1000000000`, "R005"},
+	}
+	for _, tt := range tests {
+		_, err := in.Eval(context.Background(), tt.input)
+		var evalErr *Error
+		if !errors.As(err, &evalErr) || evalErr.Diagnostics[0].Code != tt.expectedCode {
+			t.Errorf("expected a %s error for %q. got=%v", tt.expectedCode, tt.input, err)
+		}
+	}
+
+	// the interpreter stays usable after a limit is hit
+	if result, err := in.Eval(context.Background(), "1 + 1"); err != nil || FromObject(result) != int64(2) {
+		t.Errorf("Eval after a limit failed. got=%v, %v", result, err)
+	}
+
+	in.SetLimits(Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := in.Eval(ctx, "let i = 0; while (true) { i++ }"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded. got=%v", err)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected any
+	}{
+		{nil, nil},
+		{true, true},
+		{7, int64(7)},
+		{uint8(7), int64(7)},
+		{1.5, 1.5},
+		{"hi", "hi"},
+		{[]string{"a", "b"}, []any{"a", "b"}},
+		{[]any{1, "x", false}, []any{int64(1), "x", false}},
+		{map[int]bool{1: true}, map[any]any{int64(1): true}},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Fatalf("ToObject(%v) returned error: %s", tt.input, err)
+		}
+		if got := FromObject(obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("round trip of %v wrong. expected=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	hash := MustObject(map[any]int{"b": 1, 10: 2, "a": 3, 9: 4, true: 5})
+	if got := hash.Inspect(); got != "{true: 5, 9: 4, 10: 2, a: 3, b: 1}" {
+		t.Errorf("map keys not sorted. got=%s", got)
+	}
+
+	// a value containing itself converts to a slice containing itself
+	cyclic, err := New().Eval(context.Background(), "let a = [1, 2]; a[1] = a; a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := FromObject(cyclic).([]any)
+	if len(got) != 2 {
+		t.Fatalf("wrong conversion of a cyclic array. got=%v", got)
+	}
+	if inner, ok := got[1].([]any); !ok || &inner[0] != &got[0] {
+		t.Errorf("cycle not kept. got=%v", got)
+	}
+
+	if _, err := ToObject(uint64(1 << 63)); err == nil {
+		t.Errorf("expected overflow error")
+	}
+	if _, err := ToObject(struct{}{}); err == nil {
+		t.Errorf("expected unsupported type error")
+	}
+
+	// the other way round a Go value containing itself cannot be converted,
+	// a value shared without a cycle can
+	slice := []any{1, nil}
+	slice[1] = slice
+	m := map[string]any{}
+	m["m"] = m
+	var ptr any
+	ptr = &ptr
+	for _, v := range []any{slice, m, ptr} {
+		if _, err := ToObject(v); err == nil || !strings.Contains(err.Error(), "contains itself") {
+			t.Errorf("expected error for %T containing itself. got=%v", v, err)
+		}
+	}
+	shared := []int{1}
+	if obj, err := ToObject([][]int{shared, shared}); err != nil || obj.Inspect() != "[[1], [1]]" {
+		t.Errorf("wrong conversion of a shared slice. got=%v, %v", obj, err)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var out strings.Builder
+	in := New()
+	in.SetOutput(&out)
+	if _, err := in.Eval(context.Background(), `puts("a", 1); puts([2])`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "a 1\n[2]\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func ExampleInterpreter_Eval() {
+	in := New()
+	in.Set("name", "world")
+
+	result, err := in.Eval(context.Background(), `"hello " + name`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(FromObject(result))
+	// Output: hello world
+}